@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	"github.com/spf13/cobra"
+)
+
+var archiveFormat string
+
+func init() {
+	archiveCommand.Flags().StringVarP(&archiveFormat, "format", "f", "tar", "Archive format: tar or zip")
+	rootCommand.AddCommand(archiveCommand)
+}
+
+var archiveCommand = &cobra.Command{
+	Use:   "archive REMOTE_DIR",
+	Short: "Write folder contents as tar or zip archive to stdout",
+	Args:  cobra.ExactArgs(1),
+	RunE:  archiveFolder,
+}
+
+func archiveFolder(command *cobra.Command, args []string) error {
+	var format icloud.ArchiveFormat
+	switch archiveFormat {
+	case "tar":
+		format = icloud.ArchiveTar
+	case "zip":
+		format = icloud.ArchiveZip
+	default:
+		return fmt.Errorf("invalid archive format %q", archiveFormat)
+	}
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	folder, err := drive.Lookup(args[0])
+	if err != nil {
+		return err
+	}
+	return folder.Archive(os.Stdout, format)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	log "github.com/sirupsen/logrus"
+)
+
+var bwLimit string
+
+func init() {
+	rootCommand.PersistentFlags().StringVar(&bwLimit, "bwlimit", bwLimit,
+		`Bandwidth limit: RATE, UP:DOWN or a timetable like "08:00,512K 19:00,off"`)
+}
+
+// bwSlot is a timetable entry starting at given minute of day
+type bwSlot struct {
+	minute   int
+	up, down int64
+}
+
+// applyBwLimit sets drive bandwidth limits according to --bwlimit
+// and follows the timetable in background
+func applyBwLimit(drive *icloud.DriveService) error {
+	if bwLimit == "" {
+		return nil
+	}
+	slots, err := parseBwLimit(bwLimit)
+	if err != nil {
+		return err
+	}
+	current := currentBwSlot(slots, time.Now())
+	drive.SetUploadLimit(current.up)
+	drive.SetDownloadLimit(current.down)
+	if len(slots) > 1 {
+		go func() {
+			for now := range time.Tick(time.Minute) {
+				if slot := currentBwSlot(slots, now); slot != current {
+					log.Infof("Bandwidth limit changed to %d:%d bytes/s", slot.up, slot.down)
+					drive.SetUploadLimit(slot.up)
+					drive.SetDownloadLimit(slot.down)
+					current = slot
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// currentBwSlot returns timetable slot active at given time
+func currentBwSlot(slots []bwSlot, now time.Time) bwSlot {
+	minute := now.Hour()*60 + now.Minute()
+	current := slots[len(slots)-1] // last slot continues past midnight
+	for _, slot := range slots {
+		if slot.minute <= minute {
+			current = slot
+		}
+	}
+	return current
+}
+
+// parseBwLimit parses bandwidth limit or timetable
+func parseBwLimit(spec string) ([]bwSlot, error) {
+	slots := []bwSlot{}
+	for _, field := range strings.Fields(spec) {
+		slot := bwSlot{}
+		rates := field
+		if pos := strings.Index(field, ","); pos >= 0 {
+			t, err := time.Parse("15:04", field[:pos])
+			if err != nil {
+				return nil, fmt.Errorf("invalid time in bandwidth timetable %q", field)
+			}
+			slot.minute = t.Hour()*60 + t.Minute()
+			rates = field[pos+1:]
+		} else if len(strings.Fields(spec)) > 1 {
+			return nil, fmt.Errorf("missing time in bandwidth timetable %q", field)
+		}
+		up, down := rates, rates
+		if pos := strings.Index(rates, ":"); pos >= 0 {
+			up, down = rates[:pos], rates[pos+1:]
+		}
+		var err error
+		if slot.up, err = parseRate(up); err == nil {
+			slot.down, err = parseRate(down)
+		}
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, slot)
+	}
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("invalid bandwidth limit %q", spec)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].minute < slots[j].minute })
+	return slots, nil
+}
+
+// parseRate parses rate like 512K or 1.5M in bytes per second, "off" means unlimited
+func parseRate(rate string) (int64, error) {
+	if rate == "off" || rate == "" {
+		return 0, nil
+	}
+	mult := 1.0
+	switch strings.ToUpper(rate[len(rate)-1:]) {
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		rate = rate[:len(rate)-1]
+	}
+	val, err := strconv.ParseFloat(rate, 64)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("invalid rate %q", rate)
+	}
+	return int64(val * mult), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate string
+		want int64
+		ok   bool
+	}{
+		{"off", 0, true},
+		{"", 0, true},
+		{"100", 100, true},
+		{"512K", 512 << 10, true},
+		{"512k", 512 << 10, true},
+		{"1.5M", 3 << 19, true},
+		{"2G", 2 << 30, true},
+		{"-1", 0, false},
+		{"fast", 0, false},
+		{"K", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseRate(tt.rate)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("parseRate(%q) = %d, %v", tt.rate, got, err)
+		}
+	}
+}
+
+func TestParseBwLimit(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []bwSlot
+	}{
+		{"1M", []bwSlot{{0, 1 << 20, 1 << 20}}},
+		{"10K:1M", []bwSlot{{0, 10 << 10, 1 << 20}}},
+		{"off:1M", []bwSlot{{0, 0, 1 << 20}}},
+		{"19:00,off 08:00,512K", []bwSlot{{8 * 60, 512 << 10, 512 << 10}, {19 * 60, 0, 0}}},
+		{"08:30,1K:2K", []bwSlot{{8*60 + 30, 1 << 10, 2 << 10}}},
+		{"", nil},
+		{"08:00,1M off", nil},
+		{"25:00,1M", nil},
+		{"08:00,fast", nil},
+		{"1M:fast", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseBwLimit(tt.spec)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseBwLimit(%q) = %v, want error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseBwLimit(%q) = %v, %v, want %v", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestCurrentBwSlot(t *testing.T) {
+	slots, err := parseBwLimit("08:00,512K 12:30,1M 19:00,off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		clock string
+		want  int64
+	}{
+		{"00:00", 0}, // last slot continues past midnight
+		{"07:59", 0},
+		{"08:00", 512 << 10},
+		{"12:29", 512 << 10},
+		{"12:30", 1 << 20},
+		{"18:59", 1 << 20},
+		{"19:00", 0},
+		{"23:59", 0},
+	}
+	for _, tt := range tests {
+		now, _ := time.Parse("15:04", tt.clock)
+		if got := currentBwSlot(slots, now); got.up != tt.want || got.down != tt.want {
+			t.Errorf("at %s got %+v, want %d", tt.clock, got, tt.want)
+		}
+	}
+}
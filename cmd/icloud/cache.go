@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	useCache bool
+	cacheTTL time.Duration
+	offline  bool
+	longList bool
+
+	// cachedDrive is saved on exit
+	cachedDrive *icloud.DriveService
+)
+
+func init() {
+	flags := rootCommand.PersistentFlags()
+	flags.BoolVar(&useCache, "cache", useCache, "Keep drive metadata cache on disk")
+	flags.DurationVar(&cacheTTL, "cache-ttl", icloud.DefaultCacheTTL, "How long cached root listing is trusted, other listings are validated by etag")
+	flags.BoolVar(&offline, "offline", offline, "List folders from metadata cache without connecting, needs no password")
+
+	lsCommand.Flags().BoolVarP(&longList, "long", "l", longList, "Show size and modification time")
+	rootCommand.AddCommand(lsCommand)
+}
+
+var lsCommand = &cobra.Command{
+	Use:   "ls [REMOTE_DIR]",
+	Short: "List drive folder",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  listFolder,
+}
+
+// saveCache writes metadata cache of the opened drive
+func saveCache() {
+	if cachedDrive == nil {
+		return
+	}
+	if err := cachedDrive.SaveCache(); err != nil {
+		log.Errorf("cannot save metadata cache: %v", err)
+	}
+}
+
+func listFolder(command *cobra.Command, args []string) error {
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	path := "/"
+	if len(args) > 0 {
+		path = args[0]
+	}
+	folder, err := drive.Lookup(path)
+	if err != nil {
+		return err
+	}
+	if !folder.IsDir() {
+		return fmt.Errorf("%s: %w", path, icloud.ErrNotDir)
+	}
+	children, err := folder.Children()
+	if err != nil {
+		return err
+	}
+	for _, node := range children {
+		name := node.Name()
+		if node.IsDir() {
+			name += "/"
+		}
+		if longList {
+			fmt.Printf("%12d  %s  %s\n", node.Size(), node.ModTime().Local().Format("2006-01-02 15:04"), name)
+		} else {
+			fmt.Println(name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestOpenOfflineDrive(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	defer func(u, p string, o bool) {
+		username, password, offline, cachedDrive = u, p, o, nil
+	}(username, password, offline)
+	username, password, offline = "user@example.com", "", true
+
+	drive, err := openDrive()
+	if err != nil {
+		t.Fatalf("offline drive without password: %v", err)
+	}
+	if _, err = drive.Root(); err == nil {
+		t.Error("empty cache listed root offline")
+	}
+	username = ""
+	if _, err = openDrive(); err == nil {
+		t.Error("offline drive opened without username")
+	}
+}
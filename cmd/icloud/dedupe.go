@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dedupeOptions icloud.DedupeOptions
+	dedupeMode    string
+)
+
+func init() {
+	flags := dedupeCommand.Flags()
+	flags.StringVarP(&dedupeMode, "mode", "m", "rename", "How to resolve duplicates: newest, largest, rename, trash, all of them change the drive")
+	flags.BoolVarP(&dedupeOptions.Recursive, "recursive", "r", false, "Descend into subfolders")
+	flags.BoolVarP(&dedupeOptions.DryRun, "dry-run", "n", false, "Only show what would be done")
+	rootCommand.AddCommand(dedupeCommand)
+}
+
+var dedupeCommand = &cobra.Command{
+	Use:   "dedupe REMOTE_DIR",
+	Short: "Find and resolve files with the same name in a folder",
+	Long: `Find and resolve files with the same name in a folder.
+Modes:
+  newest   keep the most recently modified file, trash others
+  largest  keep the largest file, trash others
+  rename   give duplicates unique names, folders included
+  trash    trash files with content identical to an older copy
+Every mode, including the default rename, changes the drive,
+use --dry-run to see what would be done.`,
+	Args: cobra.ExactArgs(1),
+	RunE: dedupeFolder,
+}
+
+// parseDedupeMode parses dedupe mode
+func parseDedupeMode(mode string) (icloud.DedupeMode, error) {
+	switch mode {
+	case "newest":
+		return icloud.DedupeNewest, nil
+	case "largest":
+		return icloud.DedupeLargest, nil
+	case "rename":
+		return icloud.DedupeRename, nil
+	case "trash":
+		return icloud.DedupeTrash, nil
+	}
+	return 0, fmt.Errorf("invalid dedupe mode %q", mode)
+}
+
+func dedupeFolder(command *cobra.Command, args []string) error {
+	opts := dedupeOptions
+	var err error
+	if opts.Mode, err = parseDedupeMode(dedupeMode); err != nil {
+		return err
+	}
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	folder, err := drive.Lookup(args[0])
+	if err != nil {
+		return err
+	}
+	actions, err := icloud.Dedupe(folder, opts)
+	for _, action := range actions {
+		if action.Op == icloud.DedupeRenamed {
+			fmt.Printf("%-6s %s -> %s\n", action.Op, action.Path, action.NewName)
+		} else {
+			fmt.Printf("%-6s %s\n", action.Op, action.Path)
+		}
+	}
+	return err
+}
@@ -16,6 +16,9 @@ var (
 	username string
 	password string
 	verbose  int
+
+	ignoreCase bool
+	rawNames   bool
 )
 
 func init() {
@@ -23,28 +26,33 @@ func init() {
 	cobra.EnableCommandSorting = false
 
 	// Disable alphabetical sorting of flags in help output.
-	flags := rootCommand.Flags()
+	flags := rootCommand.PersistentFlags()
 	flags.SortFlags = false
 
 	flags.StringVarP(&username, "username", "u", username, "Apple ID to use")
 	flags.StringVarP(&password, "password", "p", password, "Apple ID password to use")
 	flags.CountVarP(&verbose, "verbose", "v", "Log more stuff")
+	flags.BoolVarP(&ignoreCase, "ignore-case", "i", ignoreCase, "Match drive names ignoring case like iCloud does")
+	flags.BoolVar(&rawNames, "raw-names", rawNames, "Do not encode characters invalid in local file names")
 }
 
 func main() {
-	if err := rootCommand.Execute(); err != nil {
+	err := rootCommand.Execute()
+	saveCache()
+	if err != nil {
 		os.Exit(1)
 	}
 }
 
 var rootCommand = &cobra.Command{
-	Use:          "icloud",
-	Short:        "Apple iCloud CLI",
-	RunE:         rootMain,
-	SilenceUsage: true,
+	Use:               "icloud",
+	Short:             "Apple iCloud CLI",
+	PersistentPreRunE: setupLogging,
+	RunE:              rootMain,
+	SilenceUsage:      true,
 }
 
-func rootMain(command *cobra.Command, _ []string) error {
+func setupLogging(command *cobra.Command, _ []string) error {
 	if verbose < 0 {
 		verbose = 0
 	}
@@ -67,34 +75,42 @@ func rootMain(command *cobra.Command, _ []string) error {
 		TimestampFormat: "06-01-02 15:04:05.000",
 	})
 	icloud.Debug = level >= log.DebugLevel
+	return nil
+}
 
+// newClient returns iCloud client with saved session, not authenticated yet
+func newClient() (*icloud.Client, error) {
 	if username == "" || password == "" {
-		return errors.New("username or password was not supplied")
+		return nil, errors.New("username or password was not supplied")
 	}
+	return icloud.NewClient(username, password, "", "")
+}
 
-	cli, err := icloud.NewClient(username, password, "", "")
+// login authenticates with iCloud, asking for verification codes if needed
+func login() (*icloud.Client, error) {
+	cli, err := newClient()
 	if err == nil {
 		err = cli.Authenticate(false, "")
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if cli.Requires2SA() {
 		log.Warn("Two-step authentication required.")
 		devices, err := cli.TrustedDevices()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		log.Warnf("Your trusted devices are: %#v", devices)
 		dev := &devices[0]
 		log.Warnf("Sending verification code to the first device...")
 		if err = cli.SendVerificationCode(dev); err != nil {
-			return err
+			return nil, err
 		}
 		code := icloud.ReadLine("Please enter validation code: ")
 		if err = cli.ValidateVerificationCode(dev, code); err != nil {
-			return fmt.Errorf("failed to verify verification code: %w", err)
+			return nil, fmt.Errorf("failed to verify verification code: %w", err)
 		}
 	}
 
@@ -102,22 +118,77 @@ func rootMain(command *cobra.Command, _ []string) error {
 		log.Warnf("Two-factor authentication required.")
 		code := icloud.ReadLine("Enter the code you received of one of your approved devices: ")
 		if err = cli.Validate2FACode(code); err != nil {
-			return fmt.Errorf("failed to verify security code: %w", err)
+			return nil, fmt.Errorf("failed to verify security code: %w", err)
 		}
 		if !cli.IsTrustedSession() {
 			log.Infof("Session is not trusted. Requesting trust...")
 			if err = cli.TrustSession(); err != nil {
 				log.Errorf("Failed to request trust. You will likely be prompted for the code again in the coming weeks")
-				return err
+				return nil, err
 			}
 		}
 	}
 
 	log.Infof("Successfully authenticated")
+	return cli, nil
+}
+
+// openDrive connects to the drive service honoring cache flags
+func openDrive() (*icloud.DriveService, error) {
+	opts := icloud.CacheOptions{TTL: cacheTTL}
+	if offline {
+		// offline drive needs only the data directory of the account
+		if username == "" {
+			return nil, errors.New("username was not supplied")
+		}
+		cli, err := icloud.NewClient(username, "", "", "")
+		if err != nil {
+			return nil, err
+		}
+		cachedDrive = icloud.NewOfflineDrive(cli, opts)
+		setNaming(cachedDrive)
+		return cachedDrive, nil
+	}
+	drive, err := connectDrive()
+	if err != nil {
+		return nil, err
+	}
+	setNaming(drive)
+	if useCache {
+		drive.EnableCache(opts)
+		cachedDrive = drive
+	}
+	return drive, nil
+}
+
+// setNaming applies name matching and encoding flags
+func setNaming(drive *icloud.DriveService) {
+	drive.SetCaseInsensitive(ignoreCase)
+	if rawNames {
+		drive.SetEncoding(icloud.EncodeNone)
+	}
+}
 
+// connectDrive logs in and connects to the drive service
+func connectDrive() (*icloud.DriveService, error) {
+	cli, err := login()
+	if err != nil {
+		return nil, err
+	}
 	drive, err := icloud.NewDrive(cli)
 	if err != nil {
-		return fmt.Errorf("cannot connect to drive service: %w", err)
+		return nil, fmt.Errorf("cannot connect to drive service: %w", err)
+	}
+	if err = applyBwLimit(drive); err != nil {
+		return nil, err
+	}
+	return drive, nil
+}
+
+func rootMain(command *cobra.Command, _ []string) error {
+	drive, err := openDrive()
+	if err != nil {
+		return err
 	}
 	root, err := drive.Root()
 	if err != nil {
@@ -147,7 +218,6 @@ func rootMain(command *cobra.Command, _ []string) error {
 	if file, err := subdir.Get(""); err == nil {
 		log.Infof("remove test artifact with empty name")
 		_ = file.Delete()
-		subdir.Stale()
 	}
 
 	dir, _ = subdir.Dir()
@@ -176,8 +246,12 @@ func rootMain(command *cobra.Command, _ []string) error {
 			log.Infof("removing %q returns %v", name, err)
 		}
 	}
-	err = subdir.Upload(path)
-	log.Infof("uploading %q returns %v", path, err)
+	file, err = subdir.Upload(path)
+	if err == nil {
+		log.Infof("uploaded %q as %q id %q etag %q", path, file.Name(), file.ID(), file.Etag())
+	} else {
+		log.Infof("uploading %q returns %v", path, err)
+	}
 	dir, _ = subdir.Dir()
 	log.Infof("final subdir list %q", dir)
 
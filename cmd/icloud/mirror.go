@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mirrorOptions icloud.MirrorOptions
+	mirrorReverse bool
+	mirrorInclude []string
+	mirrorExclude []string
+)
+
+func init() {
+	flags := mirrorCommand.Flags()
+	flags.BoolVar(&mirrorReverse, "reverse", false, "Make local tree match the remote one")
+	flags.BoolVarP(&mirrorOptions.Checksum, "checksum", "c", false, "Compare files by checksum instead of size and time")
+	flags.BoolVar(&mirrorOptions.Delete, "delete", false, "Delete files missing on the source side, remote ones go to iCloud trash, local ones are removed for good unless --backup is set")
+	flags.StringVar(&mirrorOptions.Backup, "backup", "", "Move local files deleted with --reverse --delete into this directory")
+	flags.BoolVarP(&mirrorOptions.DryRun, "dry-run", "n", false, "Only show what would be done")
+	flags.StringSliceVar(&mirrorInclude, "include", nil, "Transfer only files matching pattern")
+	flags.StringSliceVar(&mirrorExclude, "exclude", nil, "Skip files matching pattern")
+	flags.BoolVarP(&noProgress, "no-progress", "q", noProgress, "Do not show progress bar")
+	rootCommand.AddCommand(mirrorCommand)
+}
+
+var mirrorCommand = &cobra.Command{
+	Use:   "mirror LOCAL REMOTE",
+	Short: "Make remote folder match local directory",
+	Args:  cobra.ExactArgs(2),
+	RunE:  mirrorFolder,
+}
+
+func mirrorFolder(command *cobra.Command, args []string) error {
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	folder, err := drive.Lookup(args[1])
+	if err != nil {
+		return err
+	}
+	opts := mirrorOptions
+	if mirrorReverse {
+		opts.Direction = icloud.MirrorDown
+	}
+	opts.Transfer = []icloud.TransferOption{
+		icloud.Include(mirrorInclude...),
+		icloud.Exclude(mirrorExclude...),
+	}
+	if !opts.DryRun {
+		opts.Transfer = append(opts.Transfer, transferOptions()...)
+	}
+	actions, err := icloud.Mirror(args[0], folder, opts)
+	for _, action := range actions {
+		fmt.Printf("%-6s %s\n", action.Op, action.Path)
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ivandeex/go-icloud/icloud"
+)
+
+// progressWidth is width of progress bar in characters
+const progressWidth = 30
+
+// showProgress renders transfer progress bar on stderr
+func showProgress(p icloud.Progress) {
+	percent := 100.0
+	if p.Total > 0 {
+		percent = float64(p.Bytes) * 100 / float64(p.Total)
+	}
+	filled := int(percent * progressWidth / 100)
+	if filled > progressWidth {
+		filled = progressWidth
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+	fmt.Fprintf(os.Stderr, "\r%-8s [%s] %5.1f%% %10s/s  %s",
+		p.Phase, bar, percent, icloud.FormatSize(int64(p.Rate)), p.Name)
+	if p.Phase == icloud.PhaseDone {
+		fmt.Fprintln(os.Stderr)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	"github.com/ivandeex/go-icloud/icloud/davfs"
+	"github.com/ivandeex/go-icloud/icloud/httpfs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/webdav"
+	"golang.org/x/term"
+)
+
+// Environment variables keeping secrets out of command line
+const (
+	davPasswordEnv = "ICLOUD_DAV_PASSWORD"
+	httpTokenEnv   = "ICLOUD_HTTP_TOKEN"
+)
+
+var (
+	serveAddr string
+	davUser   string
+)
+
+func init() {
+	serveCommand.PersistentFlags().StringVar(&serveAddr, "addr", "127.0.0.1:8080", "Address to listen on, other than loopback requires auth")
+	serveWebdavCommand.Flags().StringVar(&davUser, "user", "", "Basic auth user name, password is read from "+davPasswordEnv+" or prompted")
+	serveCommand.AddCommand(serveWebdavCommand, serveHTTPCommand)
+	rootCommand.AddCommand(serveCommand)
+}
+
+var serveCommand = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve iCloud Drive over network protocols",
+}
+
+var serveWebdavCommand = &cobra.Command{
+	Use:   "webdav",
+	Short: "Serve iCloud Drive over WebDAV",
+	Long: `Serve writable iCloud Drive over WebDAV.
+Without --user anyone able to connect can change and delete files,
+so only loopback address is allowed then.`,
+	Args: cobra.NoArgs,
+	RunE: serveWebdav,
+}
+
+var serveHTTPCommand = &cobra.Command{
+	Use:   "http [[PREFIX=]REMOTE_DIR ...]",
+	Short: "Serve read-only HTTP file browser",
+	Long: `Serve directory index (HTML or JSON) and file downloads over HTTP.
+Each argument shares a remote folder under optional URL prefix,
+by default the whole drive is shared at the root.
+Access token (bearer, cookie or ?token=) is read from ` + httpTokenEnv + `,
+without it only loopback address is allowed.`,
+	RunE: serveHTTP,
+}
+
+func serveWebdav(command *cobra.Command, _ []string) error {
+	davPass := ""
+	if davUser != "" {
+		var err error
+		if davPass, err = readSecret(davPasswordEnv, "WebDAV password: "); err != nil {
+			return err
+		}
+	}
+	if err := checkExposure(serveAddr, davUser != ""); err != nil {
+		return err
+	}
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	fsys, err := drive.FS()
+	if err != nil {
+		return err
+	}
+	handler := &webdav.Handler{
+		FileSystem: davfs.New(fsys),
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Infof("%s %s: %v", r.Method, r.URL.Path, err)
+			} else {
+				log.Debugf("%s %s", r.Method, r.URL.Path)
+			}
+		},
+	}
+	log.Warnf("Serving WebDAV on %s", serveAddr)
+	return http.ListenAndServe(serveAddr, basicAuth(handler, davUser, davPass))
+}
+
+func serveHTTP(command *cobra.Command, args []string) error {
+	httpToken := os.Getenv(httpTokenEnv)
+	if err := checkExposure(serveAddr, httpToken != ""); err != nil {
+		return err
+	}
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{"/"}
+	}
+	var shares []httpfs.Share
+	for _, arg := range args {
+		prefix, dir := "", arg
+		if i := strings.Index(arg, "="); i >= 0 {
+			prefix, dir = arg[:i], arg[i+1:]
+		}
+		node, err := drive.Lookup(dir)
+		if err != nil {
+			return err
+		}
+		if !node.IsDir() {
+			return fmt.Errorf("%s: %w", dir, icloud.ErrNotDir)
+		}
+		shares = append(shares, httpfs.Share{Prefix: prefix, FS: icloud.NewFS(node), Token: httpToken})
+		log.Infof("Sharing %s at /%s", dir, strings.Trim(prefix, "/"))
+	}
+	log.Warnf("Serving HTTP on %s", serveAddr)
+	return http.ListenAndServe(serveAddr, httpfs.New(shares...))
+}
+
+// readSecret returns secret from environment variable or asks for it
+func readSecret(env, prompt string) (string, error) {
+	if secret := os.Getenv(env); secret != "" {
+		return secret, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("%s is not set", env)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err == nil && len(secret) == 0 {
+		err = errors.New("empty password")
+	}
+	return string(secret), err
+}
+
+// checkExposure refuses to serve drive beyond loopback without auth
+func checkExposure(addr string, auth bool) error {
+	if auth || isLoopback(addr) {
+		return nil
+	}
+	return fmt.Errorf("%s: refusing to serve drive without auth on non-loopback address", addr)
+}
+
+// isLoopback tells whether listen address accepts only local connections
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// basicAuth protects handler with basic auth, empty user disables it
+func basicAuth(handler http.Handler, user, pass string) http.Handler {
+	if user == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(pass)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="icloud"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
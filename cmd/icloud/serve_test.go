@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestCheckExposure(t *testing.T) {
+	tests := []struct {
+		addr string
+		auth bool
+		ok   bool
+	}{
+		{"127.0.0.1:8080", false, true},
+		{"[::1]:8080", false, true},
+		{"localhost:8080", false, true},
+		{":8080", false, false},
+		{"0.0.0.0:8080", false, false},
+		{"192.168.1.2:8080", false, false},
+		{"nas.local:8080", false, false},
+		{"garbage", false, false},
+		{":8080", true, true},
+		{"192.168.1.2:8080", true, true},
+	}
+	for _, tt := range tests {
+		if err := checkExposure(tt.addr, tt.auth); (err == nil) != tt.ok {
+			t.Errorf("checkExposure(%q, %v) = %v", tt.addr, tt.auth, err)
+		}
+	}
+}
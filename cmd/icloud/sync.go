@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncPolicy string
+	syncState  string
+	syncDryRun bool
+	syncBackup string
+)
+
+func init() {
+	flags := syncCommand.Flags()
+	flags.StringVar(&syncPolicy, "policy", "newer", "Conflict policy: newer, local, remote or keep")
+	flags.StringVar(&syncState, "state", "", "Sync state file (default in data directory)")
+	flags.StringVar(&syncBackup, "backup", "", "Directory receiving deleted local files (default next to the state file)")
+	flags.BoolVarP(&syncDryRun, "dry-run", "n", false, "Only show what would be done")
+	rootCommand.AddCommand(syncCommand)
+}
+
+var syncCommand = &cobra.Command{
+	Use:   "sync LOCAL REMOTE",
+	Short: "Keep local directory and remote folder in two-way sync",
+	Args:  cobra.ExactArgs(2),
+	RunE:  syncFolder,
+}
+
+func syncFolder(command *cobra.Command, args []string) error {
+	var policy icloud.SyncPolicy
+	switch syncPolicy {
+	case "newer":
+		policy = icloud.SyncNewerWins
+	case "local":
+		policy = icloud.SyncLocalWins
+	case "remote":
+		policy = icloud.SyncRemoteWins
+	case "keep":
+		policy = icloud.SyncKeepBoth
+	default:
+		return fmt.Errorf("invalid sync policy %q", syncPolicy)
+	}
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	folder, err := drive.Lookup(args[1])
+	if err != nil {
+		return err
+	}
+	syncer, err := icloud.NewSyncer(args[0], folder, syncState)
+	if err != nil {
+		return err
+	}
+	syncer.Policy = policy
+	syncer.DryRun = syncDryRun
+	if syncBackup != "" {
+		syncer.Backup = syncBackup
+	}
+	actions, err := syncer.Run()
+	for _, action := range actions {
+		fmt.Printf("%-13s %s\n", action.Op, action.Path)
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	"github.com/spf13/cobra"
+)
+
+var (
+	noProgress     bool
+	onConflict     string
+	strictChecksum bool
+)
+
+func init() {
+	for _, command := range []*cobra.Command{getCommand, putCommand} {
+		command.Flags().BoolVarP(&noProgress, "no-progress", "q", noProgress, "Do not show progress bar")
+		rootCommand.AddCommand(command)
+	}
+	rootCommand.PersistentFlags().BoolVar(&strictChecksum, "strict-checksum", strictChecksum, "Fail transfers whose checksum cannot be verified")
+	putCommand.Flags().StringVar(&onConflict, "on-conflict", "keep", "What to do if file exists: keep, fail, overwrite, rename, skip, update")
+}
+
+var getCommand = &cobra.Command{
+	Use:   "get REMOTE [LOCAL]",
+	Short: "Download a file from iCloud Drive",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE:  getFile,
+}
+
+var putCommand = &cobra.Command{
+	Use:   "put LOCAL REMOTE_DIR",
+	Short: "Upload a file to iCloud Drive folder",
+	Args:  cobra.ExactArgs(2),
+	RunE:  putFile,
+}
+
+// transferOptions returns options common for all transfers
+func transferOptions() []icloud.TransferOption {
+	opts := []icloud.TransferOption{}
+	if !noProgress {
+		opts = append(opts, icloud.WithProgress(showProgress))
+	}
+	if strictChecksum {
+		opts = append(opts, icloud.StrictChecksum())
+	}
+	return opts
+}
+
+// parseConflict parses conflict resolution policy
+func parseConflict(policy string) (icloud.Conflict, error) {
+	switch policy {
+	case "keep":
+		return icloud.ConflictKeepBoth, nil
+	case "fail":
+		return icloud.ConflictFail, nil
+	case "overwrite":
+		return icloud.ConflictOverwrite, nil
+	case "rename":
+		return icloud.ConflictRename, nil
+	case "skip":
+		return icloud.ConflictSkip, nil
+	case "update":
+		return icloud.ConflictUpdate, nil
+	}
+	return 0, fmt.Errorf("invalid conflict policy %q", policy)
+}
+
+func getFile(command *cobra.Command, args []string) error {
+	remote := args[0]
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	node, err := drive.Lookup(remote)
+	if err != nil {
+		return err
+	}
+	local := drive.LocalName(node.Name())
+	if len(args) > 1 {
+		local = args[1]
+	}
+	return node.Download(local, transferOptions()...)
+}
+
+func putFile(command *cobra.Command, args []string) error {
+	conflict, err := parseConflict(onConflict)
+	if err != nil {
+		return err
+	}
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	folder, err := drive.Lookup(args[1])
+	if err != nil {
+		return err
+	}
+	opts := append(transferOptions(), icloud.OnConflict(conflict))
+	_, err = folder.Upload(args[0], opts...)
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	trashCommand.AddCommand(trashListCommand, trashRestoreCommand, trashPurgeCommand)
+	rootCommand.AddCommand(trashCommand)
+}
+
+var trashCommand = &cobra.Command{
+	Use:   "trash",
+	Short: "Manage iCloud Drive trash bin",
+}
+
+var trashListCommand = &cobra.Command{
+	Use:   "ls",
+	Short: "List trashed items",
+	Args:  cobra.NoArgs,
+	RunE:  trashList,
+}
+
+var trashRestoreCommand = &cobra.Command{
+	Use:   "restore NAME...",
+	Short: "Put trashed items back to their original location",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  trashRestore,
+}
+
+var trashPurgeCommand = &cobra.Command{
+	Use:   "purge [NAME...]",
+	Short: "Permanently delete trashed items or empty the trash bin",
+	RunE:  trashPurge,
+}
+
+func trashList(command *cobra.Command, _ []string) error {
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	nodes, err := drive.Trash()
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		fmt.Printf("%s  %12d  %s  %s\n",
+			node.Changed().Local().Format("2006-01-02 15:04"),
+			node.Size(), node.Name(), node.RestorePath())
+	}
+	return nil
+}
+
+func trashRestore(command *cobra.Command, args []string) error {
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	nodes, err := findTrashed(drive, args)
+	for _, node := range nodes {
+		if err == nil {
+			err = node.Restore()
+		}
+	}
+	return err
+}
+
+func trashPurge(command *cobra.Command, args []string) error {
+	drive, err := openDrive()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return drive.EmptyTrash()
+	}
+	nodes, err := findTrashed(drive, args)
+	for _, node := range nodes {
+		if err == nil {
+			err = node.DeleteForever()
+		}
+	}
+	return err
+}
+
+// findTrashed returns trashed items with given names
+func findTrashed(drive *icloud.DriveService, names []string) ([]*icloud.DriveNode, error) {
+	trash, err := drive.Trash()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*icloud.DriveNode{}
+	for _, name := range names {
+		found := false
+		for _, node := range trash {
+			if node.Name() == name {
+				nodes = append(nodes, node)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: %w", name, icloud.ErrNotFound)
+		}
+	}
+	return nodes, nil
+}
@@ -4,14 +4,16 @@ go 1.17
 
 require (
 	github.com/google/uuid v1.3.0
-	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.2.1
+	github.com/vanym/golang-netscape-cookiejar v1.0.0
+	golang.org/x/net v0.17.0
+	golang.org/x/term v0.13.0
+	golang.org/x/text v0.13.0
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	github.com/vanym/golang-netscape-cookiejar v1.0.0 // indirect
-	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
@@ -28,14 +28,23 @@ type DriveItem struct {
 	DirectCount int       `json:"directChildrenCount"`
 	FileCount   int       `json:"fileCount"`
 	ItemCount   int       `json:"numberOfItems"`
+	// Trashed items only
+	RestorePath string    `json:"restorePath"`
+	Expires     time.Time `json:"dateExpiration"`
 	// Children (folder only)
 	Items []*DriveItem `json:"items"`
 }
 
+type DriveDataToken struct {
+	URL                string `json:"url"`
+	Token              string `json:"token"`
+	Signature          string `json:"signature"`
+	WrappingKey        string `json:"wrapping_key"`
+	ReferenceSignature string `json:"reference_signature"`
+}
+
 type DriveDocResult struct {
-	DataToken struct {
-		URL string `json:"url"`
-	} `json:"data_token"`
+	DataToken DriveDataToken `json:"data_token"`
 }
 
 type DriveUploadContentWsResult struct {
@@ -54,3 +63,38 @@ type DriveUploadFileResult struct {
 		WrappingKey       string `json:"wrappingKey"`
 	} `json:"singleFile"`
 }
+
+// DriveItemsResult is returned by item rename, move and trash requests
+type DriveItemsResult struct {
+	Items []*DriveItem `json:"items"`
+}
+
+// DriveFoldersResult is returned by folder creation request
+type DriveFoldersResult struct {
+	Folders []*DriveItem `json:"folders"`
+}
+
+// DriveDocument describes a file as seen by docws
+type DriveDocument struct {
+	DocID    string `json:"document_id"`
+	ItemID   string `json:"item_id"`
+	ParentID string `json:"parent_id"`
+	Zone     string `json:"zone"`
+	Etag     string `json:"etag"`
+	Name     string `json:"name"`
+	Ext      string `json:"extension"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	Mtime    int64  `json:"mtime"`
+}
+
+// DriveUpdateResult is returned by document update request
+type DriveUpdateResult struct {
+	Results []struct {
+		Status struct {
+			Code  int    `json:"status_code"`
+			Error string `json:"error_message"`
+		} `json:"status"`
+		Document *DriveDocument `json:"document"`
+	} `json:"results"`
+}
@@ -0,0 +1,146 @@
+package icloud
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// ArchiveFormat is format of folder archive
+type ArchiveFormat int
+
+// Archive formats
+const (
+	ArchiveTar ArchiveFormat = iota
+	ArchiveZip
+)
+
+// archiveWriter adds folder entries to an archive
+type archiveWriter interface {
+	addDir(name string, mtime time.Time) error
+	addFile(name string, size int64, mtime time.Time, in io.Reader) error
+	Close() error
+}
+
+// Archive streams folder contents recursively into a tar or zip archive
+func (n *DriveNode) Archive(w io.Writer, format ArchiveFormat) error {
+	if !n.IsDir() {
+		return ErrNotDir
+	}
+	var aw archiveWriter
+	switch format {
+	case ArchiveTar:
+		aw = &tarArchive{tar.NewWriter(w)}
+	case ArchiveZip:
+		aw = &zipArchive{zip.NewWriter(w)}
+	default:
+		return fmt.Errorf("unknown archive format %d", format)
+	}
+	err := n.archive(aw, "")
+	if errClose := aw.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+func (n *DriveNode) archive(aw archiveWriter, prefix string) error {
+	children, err := n.Children()
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		name := path.Join(prefix, child.Name())
+		if child.IsDir() {
+			err = aw.addDir(name, child.Modified())
+			if err == nil {
+				err = child.archive(aw, name)
+			}
+		} else {
+			var in io.ReadCloser
+			if in, err = child.Open(); err == nil {
+				err = aw.addFile(name, child.Size(), child.Modified(), in)
+				_ = in.Close()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// tarArchive writes tar archive
+type tarArchive struct {
+	*tar.Writer
+}
+
+func (a *tarArchive) addDir(name string, mtime time.Time) error {
+	return a.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0o755,
+		ModTime:  mtime,
+	})
+}
+
+// addFile writes a file entry. Tar header needs the size up front,
+// so content of unknown size is buffered in a temporary file first.
+func (a *tarArchive) addFile(name string, size int64, mtime time.Time, in io.Reader) error {
+	if size < 0 {
+		tmp, err := os.CreateTemp("", "icloud-*")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}()
+		if size, err = io.Copy(tmp, in); err != nil {
+			return err
+		}
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		in = tmp
+	}
+	err := a.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  mtime,
+	})
+	if err == nil {
+		_, err = io.Copy(a, in)
+	}
+	return err
+}
+
+// zipArchive writes zip archive
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (a *zipArchive) addDir(name string, mtime time.Time) error {
+	_, err := a.CreateHeader(&zip.FileHeader{
+		Name:     name + "/",
+		Modified: mtime,
+	})
+	return err
+}
+
+func (a *zipArchive) addFile(name string, size int64, mtime time.Time, in io.Reader) error {
+	fw, err := a.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: mtime,
+	})
+	if err == nil {
+		_, err = io.Copy(fw, in)
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package icloud
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// archiveEntry is an entry read back from an archive
+type archiveEntry struct {
+	dir     bool
+	size    int64
+	mtime   int64 // unix time
+	content string
+}
+
+// newArchiveDrive returns fake drive with a small tree for archiving
+func newArchiveDrive(t *testing.T) *DriveNode {
+	f, d := newFakeDrive(t)
+	f.add("root", "a", "txt", false, "aaa")
+	dirID := f.add("root", "d", "", true, "")
+	f.add(dirID, "b", "txt", false, "bbbb")
+	unsized := f.add(dirID, "c", "", false, "unknown size")
+	f.items["FILE::com.apple.CloudDocs::"+unsized].Size = nil
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// wantArchive lists entries of archived fake drive tree
+func wantArchive() map[string]archiveEntry {
+	const mtime = 1600000000
+	return map[string]archiveEntry{
+		"a.txt":   {size: 3, mtime: mtime, content: "aaa"},
+		"d/":      {dir: true, mtime: mtime},
+		"d/b.txt": {size: 4, mtime: mtime, content: "bbbb"},
+		"d/c":     {size: 12, mtime: mtime, content: "unknown size"},
+	}
+}
+
+func TestArchiveTar(t *testing.T) {
+	root := newArchiveDrive(t)
+	buf := &bytes.Buffer{}
+	if err := root.Archive(buf, ArchiveTar); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]archiveEntry{}
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[hdr.Name] = archiveEntry{
+			dir:     hdr.Typeflag == tar.TypeDir,
+			size:    hdr.Size,
+			mtime:   hdr.ModTime.Unix(),
+			content: string(data),
+		}
+	}
+	if want := wantArchive(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestArchiveZip(t *testing.T) {
+	root := newArchiveDrive(t)
+	buf := &bytes.Buffer{}
+	if err := root.Archive(buf, ArchiveZip); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]archiveEntry{}
+	for _, zf := range zr.File {
+		in, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(in)
+		_ = in.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[zf.Name] = archiveEntry{
+			dir:     zf.FileInfo().IsDir(),
+			size:    int64(zf.UncompressedSize64),
+			mtime:   zf.Modified.Unix(),
+			content: string(data),
+		}
+	}
+	if want := wantArchive(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestArchiveFile(t *testing.T) {
+	root := newArchiveDrive(t)
+	node, err := root.Get("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = node.Archive(io.Discard, ArchiveTar); !errors.Is(err, ErrNotDir) {
+		t.Errorf("archiving a file got %v", err)
+	}
+}
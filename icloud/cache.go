@@ -0,0 +1,211 @@
+package icloud
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ivandeex/go-icloud/icloud/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// Cache defaults
+const (
+	DefaultCacheTTL    = time.Minute
+	DefaultCacheMaxAge = 30 * 24 * time.Hour
+	cacheSaveInterval  = 5 * time.Second
+)
+
+// CacheOptions configure persistent metadata cache.
+//
+// Folder listings are keyed by drivewsid. A listing is used without asking
+// the server if its etag matches the etag of the folder seen in the parent
+// listing. Listings which cannot be validated by etag, like the root one,
+// are trusted until TTL. In offline mode listings are served from cache
+// regardless of age and the server is never asked.
+type CacheOptions struct {
+	Path    string        // cache file, default is "metadata.json" in client data directory
+	TTL     time.Duration // how long listings without etag are trusted, default is DefaultCacheTTL
+	MaxAge  time.Duration // older listings are purged on load, default is DefaultCacheMaxAge
+	Offline bool          // serve listings only from cache
+}
+
+// cacheEntry is a cached folder listing
+type cacheEntry struct {
+	Item    *api.DriveItem `json:"item"`
+	Fetched time.Time      `json:"fetched"`
+}
+
+// metaCache persists folder listings on disk.
+// Nil cache is valid and caches nothing.
+type metaCache struct {
+	mu      sync.Mutex
+	opts    CacheOptions
+	dirty   bool
+	saved   time.Time
+	Folders map[string]*cacheEntry `json:"folders"`
+}
+
+// newMetaCache loads metadata cache from a file
+func newMetaCache(opts CacheOptions) *metaCache {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultCacheTTL
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultCacheMaxAge
+	}
+	mc := &metaCache{opts: opts, Folders: map[string]*cacheEntry{}, saved: time.Now()}
+	if opts.Path == "" {
+		return mc
+	}
+	data, err := os.ReadFile(opts.Path)
+	if err == nil {
+		err = json.Unmarshal(data, mc)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Debugf("Ignoring broken metadata cache %s: %v", opts.Path, err)
+	}
+	if mc.Folders == nil {
+		mc.Folders = map[string]*cacheEntry{}
+	}
+	for id, entry := range mc.Folders {
+		if entry == nil || entry.Item == nil || time.Since(entry.Fetched) > opts.MaxAge {
+			delete(mc.Folders, id)
+		}
+	}
+	return mc
+}
+
+// EnableCache turns on persistent metadata cache
+func (d *DriveService) EnableCache(opts CacheOptions) {
+	if opts.Path == "" {
+		opts.Path = d.c.dataPath("metadata.json")
+	}
+	d.cache = newMetaCache(opts)
+}
+
+// NewOfflineDrive returns drive service which lists folders from metadata
+// cache only. It needs no authentication, but other operations will fail.
+func NewOfflineDrive(c *Client, opts CacheOptions) *DriveService {
+	d := newDriveService(c)
+	opts.Offline = true
+	d.EnableCache(opts)
+	return d
+}
+
+// SaveCache writes pending metadata cache changes on disk
+func (d *DriveService) SaveCache() error {
+	return d.cache.save()
+}
+
+// offline returns true if server must not be asked for listings
+func (mc *metaCache) offline() bool {
+	return mc != nil && mc.opts.Offline
+}
+
+// lookup returns a copy of cached listing or nil if it's missing or stale.
+// Listing with matching etag is always fresh, empty etag applies TTL instead.
+func (mc *metaCache) lookup(driveID, etag string) *api.DriveItem {
+	if mc == nil {
+		return nil
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	entry := mc.Folders[driveID]
+	if entry == nil {
+		return nil
+	}
+	if !mc.opts.Offline {
+		switch {
+		case etag != "" && entry.Item.Etag != etag:
+			delete(mc.Folders, driveID)
+			mc.dirty = true
+			return nil
+		case etag == "" && time.Since(entry.Fetched) > mc.opts.TTL:
+			return nil
+		}
+	}
+	return cloneItem(entry.Item)
+}
+
+// store saves folder listing
+func (mc *metaCache) store(item *api.DriveItem) {
+	if mc == nil || item.DriveID == "" {
+		return
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.Folders[item.DriveID] = &cacheEntry{Item: cloneItem(item), Fetched: time.Now()}
+	mc.changed()
+}
+
+// invalidate drops listings of given folders
+func (mc *metaCache) invalidate(driveIDs ...string) {
+	if mc == nil {
+		return
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for _, id := range driveIDs {
+		if _, ok := mc.Folders[id]; ok {
+			delete(mc.Folders, id)
+			mc.changed()
+		}
+	}
+}
+
+// clear drops all listings
+func (mc *metaCache) clear() {
+	if mc == nil {
+		return
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.Folders = map[string]*cacheEntry{}
+	mc.changed()
+}
+
+// changed marks cache dirty and saves it if last save was long ago.
+// Caller must hold the lock.
+func (mc *metaCache) changed() {
+	mc.dirty = true
+	if time.Since(mc.saved) >= cacheSaveInterval {
+		_ = mc.saveLocked()
+	}
+}
+
+// save writes cache on disk if it has changed
+func (mc *metaCache) save() error {
+	if mc == nil {
+		return nil
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.saveLocked()
+}
+
+func (mc *metaCache) saveLocked() error {
+	if !mc.dirty || mc.opts.Path == "" {
+		return nil
+	}
+	mc.saved = time.Now()
+	if err := os.WriteFile(mc.opts.Path, Marshal(mc), 0600); err != nil {
+		log.Debugf("Cannot save metadata cache %s: %v", mc.opts.Path, err)
+		return err
+	}
+	mc.dirty = false
+	return nil
+}
+
+// cloneItem returns deep copy of a drive item
+func cloneItem(item *api.DriveItem) *api.DriveItem {
+	clone := *item
+	if item.Items != nil {
+		clone.Items = make([]*api.DriveItem, len(item.Items))
+		for i, child := range item.Items {
+			clone.Items[i] = cloneItem(child)
+		}
+	}
+	return &clone
+}
@@ -0,0 +1,86 @@
+package icloud
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivandeex/go-icloud/icloud/api"
+)
+
+func TestCacheLookup(t *testing.T) {
+	const id = "FOLDER::com.apple.CloudDocs::x"
+	tests := []struct {
+		name    string
+		offline bool
+		age     time.Duration
+		etag    string
+		hit     bool
+		kept    bool
+	}{
+		{"matching etag", false, time.Second, "e1", true, true},
+		{"matching etag beyond ttl", false, time.Hour, "e1", true, true},
+		{"changed etag", false, time.Second, "e2", false, false},
+		{"no etag", false, time.Second, "", true, true},
+		{"no etag beyond ttl", false, time.Hour, "", false, true},
+		{"offline changed etag", true, time.Hour, "e2", true, true},
+	}
+	for _, tt := range tests {
+		mc := newMetaCache(CacheOptions{TTL: time.Minute, Offline: tt.offline})
+		mc.Folders[id] = &cacheEntry{Item: &api.DriveItem{DriveID: id, Etag: "e1"}, Fetched: time.Now().Add(-tt.age)}
+		item := mc.lookup(id, tt.etag)
+		if hit := item != nil; hit != tt.hit {
+			t.Errorf("%s: hit %v, want %v", tt.name, hit, tt.hit)
+		}
+		if _, kept := mc.Folders[id]; kept != tt.kept {
+			t.Errorf("%s: kept %v, want %v", tt.name, kept, tt.kept)
+		}
+	}
+	var mc *metaCache
+	if mc.lookup(id, "") != nil {
+		t.Error("nil cache returned listing")
+	}
+}
+
+func TestCacheSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.json")
+	mc := newMetaCache(CacheOptions{Path: path, MaxAge: time.Hour})
+	mc.store(&api.DriveItem{DriveID: "fresh", Etag: "e1", Items: []*api.DriveItem{{DriveID: "child"}}})
+	mc.store(&api.DriveItem{DriveID: "old", Etag: "e2"})
+	mc.Folders["old"].Fetched = time.Now().Add(-2 * time.Hour)
+	if err := mc.save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newMetaCache(CacheOptions{Path: path, MaxAge: time.Hour})
+	item := loaded.lookup("fresh", "e1")
+	if item == nil || len(item.Items) != 1 || item.Items[0].DriveID != "child" {
+		t.Fatalf("got %+v", item)
+	}
+	if _, ok := loaded.Folders["old"]; ok {
+		t.Error("listing older than max age was loaded")
+	}
+}
+
+func TestCacheAfterMutation(t *testing.T) {
+	f, d := newFakeDrive(t)
+	d.EnableCache(CacheOptions{})
+	docsID := f.add("root", "docs", "", true, "")
+	f.add(docsID, "a", "txt", false, "aaa")
+	docs, err := d.Lookup("/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = docs.Children(); err != nil {
+		t.Fatal(err)
+	}
+	etag := docs.Etag()
+	if d.cache.lookup(docs.ID(), etag) == nil {
+		t.Fatal("listing was not cached")
+	}
+	if _, err = docs.Mkdir("sub"); err != nil {
+		t.Fatal(err)
+	}
+	if d.cache.lookup(docs.ID(), etag) != nil {
+		t.Error("patched listing is valid for etag before mutation")
+	}
+}
@@ -0,0 +1,46 @@
+package icloud
+
+import (
+	"crypto/sha1" //nolint:gosec // required by iCloud
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// sigTypeSHA1 marks iCloud signature made of SHA-1 digest of the whole file
+const sigTypeSHA1 = 0x01
+
+// NewSignatureHash returns a hash computing iCloud content signature.
+// Signature is a type byte 0x01 followed by SHA-1 digest of the data.
+func NewSignatureHash() hash.Hash {
+	return sha1.New() //nolint:gosec // required by iCloud
+}
+
+// EncodeSignature returns base64-encoded iCloud signature of a hash
+func EncodeSignature(h hash.Hash) string {
+	sig := append([]byte{sigTypeSHA1}, h.Sum(nil)...)
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// Signature computes iCloud content signature of a stream
+func Signature(in io.Reader) (string, error) {
+	h := NewSignatureHash()
+	if _, err := io.Copy(h, in); err != nil {
+		return "", err
+	}
+	return EncodeSignature(h), nil
+}
+
+// verifySignature compares server signature with locally computed one.
+// Missing signatures and signatures of unknown schemes yield ErrUnverifiable.
+func verifySignature(name, want string, h hash.Hash) error {
+	raw, err := base64.StdEncoding.DecodeString(want)
+	if err != nil || len(raw) != 1+sha1.Size || raw[0] != sigTypeSHA1 {
+		return fmt.Errorf("%s: %w: signature %q", name, ErrUnverifiable, want)
+	}
+	if got := EncodeSignature(h); got != want {
+		return fmt.Errorf("%s: %w: got %s, want %s", name, ErrChecksum, got, want)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package icloud
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+	for content, want := range map[string]string{
+		"":      "Ado5o+5ea0sNMlW/75VgGJCv2AcJ",
+		"hello": "Aar0xh3cxeii2r7eDztILNmuqUNN",
+	} {
+		if got, err := Signature(strings.NewReader(content)); err != nil || got != want {
+			t.Errorf("Signature(%q) = %q, %v, want %q", content, got, err, want)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	tests := []struct {
+		sig  string
+		want error
+	}{
+		{"Aar0xh3cxeii2r7eDztILNmuqUNN", nil},
+		{"Ado5o+5ea0sNMlW/75VgGJCv2AcJ", ErrChecksum},
+		{"Aqr0xh3cxeii2r7eDztILNmuqUNN", ErrUnverifiable}, // unknown scheme
+		{"Aar0xh3c", ErrUnverifiable},
+		{"not base64!", ErrUnverifiable},
+		{"", ErrUnverifiable},
+	}
+	for _, tt := range tests {
+		h := NewSignatureHash()
+		_, _ = h.Write([]byte("hello"))
+		err := verifySignature("file", tt.sig, h)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("verifySignature(%q) = %v, want %v", tt.sig, err, tt.want)
+		}
+	}
+}
+
+func TestChecksumPolicy(t *testing.T) {
+	unverifiable := verifySignature("file", "", NewSignatureHash())
+	if err := newTransferOptions(nil).checked(unverifiable); err != nil {
+		t.Errorf("default policy returned %v", err)
+	}
+	if err := newTransferOptions([]TransferOption{StrictChecksum()}).checked(unverifiable); !errors.Is(err, ErrUnverifiable) {
+		t.Errorf("strict policy returned %v", err)
+	}
+	if err := newTransferOptions(nil).checked(ErrChecksum); err != ErrChecksum {
+		t.Errorf("mismatch became %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package icloud
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/ivandeex/go-icloud/icloud/api"
@@ -32,6 +34,7 @@ type Client struct {
 	password    string
 	withFamily  bool
 	session     sessionData
+	sessMu      sync.Mutex // guards session updates
 	sessPath    string
 	params      dict
 	data        *api.StateResponse
@@ -99,18 +102,28 @@ func NewClientWithOptions(client *http.Client, appleID, password, userAgent, ses
 
 // get request
 func (c *Client) get(url string, res interface{}) error {
-	_, err := c.request(http.MethodGet, url, nil, nil, res, false)
+	return c.getContext(context.Background(), url, res)
+}
+
+// getContext is get request canceled with context
+func (c *Client) getContext(ctx context.Context, url string, res interface{}) error {
+	_, err := c.request(ctx, http.MethodGet, url, nil, nil, res, false)
 	return err
 }
 
 // post request
 func (c *Client) post(url string, data interface{}, hdr dict, res interface{}) error {
-	_, err := c.request(http.MethodPost, url, data, hdr, res, false)
+	return c.postContext(context.Background(), url, data, hdr, res)
+}
+
+// postContext is post request canceled with context
+func (c *Client) postContext(ctx context.Context, url string, data interface{}, hdr dict, res interface{}) error {
+	_, err := c.request(ctx, http.MethodPost, url, data, hdr, res, false)
 	return err
 }
 
 // request will send a get/post request with retries
-func (c *Client) request(method, url string, data interface{}, hdr dict, out interface{}, retried bool) ([]byte, error) {
+func (c *Client) request(ctx context.Context, method, url string, data interface{}, hdr dict, out interface{}, retried bool) ([]byte, error) {
 	var (
 		rd    io.Reader
 		in    []byte
@@ -152,7 +165,7 @@ func (c *Client) request(method, url string, data interface{}, hdr dict, out int
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(method, url, rd)
+	req, err := http.NewRequestWithContext(ctx, method, url, rd)
 	if err != nil {
 		return nil, err
 	}
@@ -161,6 +174,13 @@ func (c *Client) request(method, url string, data interface{}, hdr dict, out int
 	for k, v := range hdr {
 		h.Set(k, fmt.Sprintf("%s", v))
 	}
+	if clength := h.Get("Content-Length"); clength != "" {
+		// net/http ignores the header, so stream length must be set explicitly
+		h.Del("Content-Length")
+		if req.ContentLength, err = strconv.ParseInt(clength, 10, 64); err != nil {
+			return nil, err
+		}
+	}
 	h.Set("Origin", HomeEndpoint)
 	h.Set("Referer", HomeEndpoint+"/")
 	if c.userAgent != "" {
@@ -172,14 +192,27 @@ func (c *Client) request(method, url string, data interface{}, hdr dict, out int
 		return nil, err
 	}
 
+	c.sessMu.Lock()
 	c.session.applyResponseHeaders(res.Header)
-	if err := c.session.save(c.sessPath); err != nil {
+	err = c.session.save(c.sessPath)
+	c.sessMu.Unlock()
+	if err != nil {
 		return nil, err
 	}
 	log.Tracef("Saved session in %s", c.sessPath)
 
 	if streamPtr, wantStream := out.(*io.ReadCloser); wantStream {
 		log.Tracef("streaming data from url %q", url)
+		code := res.StatusCode
+		if code >= 400 {
+			_ = res.Body.Close()
+			status := strings.TrimSpace(strings.TrimPrefix(res.Status, strconv.Itoa(code)))
+			return nil, NewErrAPI(code, status, "", false)
+		}
+		if code != http.StatusPartialContent && req.Header.Get("Range") != "" {
+			_ = res.Body.Close()
+			return nil, ErrNoRange
+		}
 		*streamPtr = res.Body
 		return nil, nil
 	}
@@ -215,11 +248,11 @@ func (c *Client) request(method, url string, data interface{}, hdr dict, out int
 			if err := c.Authenticate(true, "find"); err != nil {
 				log.Debug("Re-authentication failed")
 			}
-			return c.request(method, url, data, hdr, out, true)
+			return c.request(ctx, method, url, data, hdr, out, true)
 		}
 		if !retried && isAuthErr {
 			log.Debugf("Auth error %s (%d). Retrying...", status, code)
-			return c.request(method, url, data, hdr, out, true)
+			return c.request(ctx, method, url, data, hdr, out, true)
 		}
 		return nil, c.translateError(code, status, status)
 	}
@@ -0,0 +1,90 @@
+// Package davfs implements WebDAV file system over iCloud Drive
+package davfs
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	"golang.org/x/net/webdav"
+)
+
+// FileSystem implements webdav.FileSystem over a drive file system
+type FileSystem struct {
+	fsys *icloud.DriveFS
+}
+
+// New returns WebDAV file system
+func New(fsys *icloud.DriveFS) *FileSystem {
+	return &FileSystem{fsys: fsys}
+}
+
+// fsPath converts WebDAV path into fs path
+func fsPath(name string) string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// Mkdir implements webdav.FileSystem
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return f.fsys.Mkdir(fsPath(name), perm)
+}
+
+// OpenFile implements webdav.FileSystem
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	file, err := f.fsys.OpenFile(fsPath(name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &davFile{file}, nil
+}
+
+// RemoveAll implements webdav.FileSystem
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	if fsPath(name) == "." {
+		return os.ErrPermission
+	}
+	return f.fsys.RemoveAll(fsPath(name))
+}
+
+// Rename implements webdav.FileSystem
+func (f *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	return f.fsys.Rename(fsPath(oldName), fsPath(newName))
+}
+
+// Stat implements webdav.FileSystem
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return f.fsys.Stat(fsPath(name))
+}
+
+// davFile adds Readdir to a drive file
+type davFile struct {
+	icloud.WritableFile
+}
+
+// Readdir implements http.File
+func (f *davFile) Readdir(count int) ([]fs.FileInfo, error) {
+	dir, ok := f.WritableFile.(fs.ReadDirFile)
+	if !ok {
+		return nil, icloud.ErrNotDir
+	}
+	entries, err := dir.ReadDir(count)
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, errInfo := entry.Info()
+		if errInfo != nil {
+			return infos, errInfo
+		}
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+// static check of implemented interfaces
+var _ webdav.FileSystem = (*FileSystem)(nil)
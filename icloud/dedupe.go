@@ -0,0 +1,214 @@
+package icloud
+
+import (
+	"path"
+	"sort"
+)
+
+// DedupeMode tells how same-name siblings are resolved
+type DedupeMode int
+
+// Dedupe modes. Only DedupeRename touches folders,
+// other modes resolve duplicate files and leave folders alone.
+const (
+	DedupeNewest  DedupeMode = iota // keep the most recently modified file, trash others
+	DedupeLargest                   // keep the largest file, trash others
+	DedupeRename                    // give duplicates unique names like "file 2.txt"
+	DedupeTrash                     // trash files with content identical to an older one
+)
+
+// Dedupe actions, every member of a duplicate group gets one
+const (
+	DedupeKept    ActionOp = "keep"
+	DedupeTrashed ActionOp = "trash"
+	DedupeRenamed ActionOp = "rename"
+)
+
+// DedupeOptions configures a dedupe
+type DedupeOptions struct {
+	Mode      DedupeMode
+	Recursive bool // descend into subfolders
+	DryRun    bool // report how duplicates would be resolved, leaving them as is
+}
+
+// Dedupe finds and resolves children having the same name.
+// Actions carry drivews ids, since their paths are the same.
+// Nodes failing to trash or rename are reported in *TreeError.
+func Dedupe(folder *DriveNode, opts DedupeOptions) ([]Action, error) {
+	if !folder.IsDir() {
+		return nil, ErrNotDir
+	}
+	dd := &dedupe{planner: newPlanner(opts.DryRun), opts: opts}
+	dd.folder(folder, "")
+	return dd.result()
+}
+
+// Duplicates returns groups of children having the same name
+func (n *DriveNode) Duplicates() ([][]*DriveNode, error) {
+	children, err := n.Children()
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]*DriveNode{}
+	keys := []string{}
+	for _, child := range children {
+		key := n.d.nameKey(child.Name())
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], child)
+	}
+	sort.Strings(keys)
+	dups := [][]*DriveNode{}
+	for _, key := range keys {
+		if group := groups[key]; len(group) > 1 {
+			// oldest first
+			sort.SliceStable(group, func(i, j int) bool { return group[i].i.Created.Before(group[j].i.Created) })
+			dups = append(dups, group)
+		}
+	}
+	return dups, nil
+}
+
+// dedupe keeps state of a running dedupe
+type dedupe struct {
+	*planner
+	opts DedupeOptions
+}
+
+// resolve records action on a member of duplicate group
+// and tells whether to perform it
+func (dd *dedupe) resolve(op ActionOp, rel string, node *DriveNode, newName string) bool {
+	return dd.add(Action{Op: op, Path: rel, ID: node.ID(), NewName: newName}) && op != DedupeKept
+}
+
+// folder resolves duplicates in a folder and, if recursive, in its subfolders
+func (dd *dedupe) folder(folder *DriveNode, rel string) {
+	dups, err := folder.Duplicates()
+	if err != nil {
+		dd.errs.add(rel, err)
+		return
+	}
+	for _, group := range dups {
+		if dd.opts.Mode == DedupeRename {
+			dd.rename(folder, group, rel)
+			continue
+		}
+		files := []*DriveNode{}
+		for _, node := range group {
+			if !node.IsDir() {
+				files = append(files, node)
+			}
+		}
+		if len(files) > 1 {
+			dd.files(files, rel)
+		}
+	}
+	if !dd.opts.Recursive {
+		return
+	}
+	children, err := folder.Children()
+	if err != nil {
+		dd.errs.add(rel, err)
+		return
+	}
+	for _, child := range children {
+		if child.IsDir() {
+			dd.folder(child, path.Join(rel, child.Name()))
+		}
+	}
+}
+
+// rename gives all but the oldest node of a group unique names
+func (dd *dedupe) rename(folder *DriveNode, group []*DriveNode, rel string) {
+	names, err := folder.Dir()
+	if err != nil {
+		dd.errs.add(rel, err)
+		return
+	}
+	used := map[string]bool{}
+	for _, name := range names {
+		used[folder.d.nameKey(name)] = true
+	}
+	for i, node := range group {
+		relPath := path.Join(rel, node.Name())
+		if i == 0 {
+			dd.resolve(DedupeKept, relPath, node, "")
+			continue
+		}
+		newName := folder.d.freeName(node.Name(), used)
+		if dd.resolve(DedupeRenamed, relPath, node, newName) {
+			if _, err := node.Rename(newName); err != nil {
+				dd.errs.add(relPath, err)
+			}
+		}
+	}
+}
+
+// files resolves a group of same-name files
+func (dd *dedupe) files(group []*DriveNode, rel string) {
+	keep := map[*DriveNode]bool{}
+	switch dd.opts.Mode {
+	case DedupeNewest, DedupeLargest:
+		best := group[0]
+		for _, node := range group[1:] {
+			if dd.opts.Mode == DedupeNewest && node.ModTime().After(best.ModTime()) ||
+				dd.opts.Mode == DedupeLargest && node.Size() > best.Size() {
+				best = node
+			}
+		}
+		keep[best] = true
+	case DedupeTrash:
+		// keep the oldest copy of every distinct content
+		var kept []*DriveNode
+		for _, node := range group {
+			same, err := dd.sameAsAny(node, kept)
+			if err != nil {
+				dd.errs.add(path.Join(rel, node.Name()), err)
+				keep[node] = true
+				continue
+			}
+			if !same {
+				kept = append(kept, node)
+				keep[node] = true
+			}
+		}
+	}
+	for _, node := range group {
+		relPath := path.Join(rel, node.Name())
+		if keep[node] {
+			dd.resolve(DedupeKept, relPath, node, "")
+			continue
+		}
+		if dd.resolve(DedupeTrashed, relPath, node, "") {
+			if err := node.Delete(); err != nil {
+				dd.errs.add(relPath, err)
+			}
+		}
+	}
+}
+
+// sameAsAny tells whether file content matches one of given files
+func (dd *dedupe) sameAsAny(node *DriveNode, others []*DriveNode) (bool, error) {
+	for _, other := range others {
+		if other.Size() != node.Size() {
+			continue
+		}
+		if node.Size() == 0 {
+			return true, nil
+		}
+		sig, err := node.Signature()
+		if err != nil {
+			return false, err
+		}
+		otherSig, err := other.Signature()
+		if err != nil {
+			return false, err
+		}
+		// unknown signatures are never considered equal
+		if sig != "" && sig == otherSig {
+			return true, nil
+		}
+	}
+	return false, nil
+}
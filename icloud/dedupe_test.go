@@ -0,0 +1,110 @@
+package icloud
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// addDup adds a file with given creation and modification times
+func (f *fakeDrive) addDup(name, ext, content string, created, modified time.Time) string {
+	id := f.add("root", name, ext, false, content)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	it := f.items["FILE::com.apple.CloudDocs::"+id]
+	it.Created, it.Modified = created, modified
+	return it.DriveID
+}
+
+// trashed tells whether fake item was moved to trash
+func (f *fakeDrive) trashed(driveID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.items[driveID].ParentID == "TRASH_ROOT"
+}
+
+func TestDedupe(t *testing.T) {
+	t1, t2, t3 := time.Unix(1600000000, 0), time.Unix(1600001000, 0), time.Unix(1600002000, 0)
+	tests := []struct {
+		mode     DedupeMode
+		unsigned bool
+		ops      []ActionOp // of oldest, newest, largest file, first and second folder
+		names    []string   // of those
+	}{
+		{DedupeNewest, false,
+			[]ActionOp{DedupeTrashed, DedupeKept, DedupeTrashed},
+			[]string{"", "a.txt", "", "dir", "dir"}},
+		{DedupeLargest, false,
+			[]ActionOp{DedupeTrashed, DedupeTrashed, DedupeKept},
+			[]string{"", "", "a.txt", "dir", "dir"}},
+		{DedupeTrash, false,
+			[]ActionOp{DedupeKept, DedupeTrashed, DedupeKept},
+			[]string{"a.txt", "", "a.txt", "dir", "dir"}},
+		{DedupeTrash, true,
+			[]ActionOp{DedupeKept, DedupeKept, DedupeKept},
+			[]string{"a.txt", "a.txt", "a.txt", "dir", "dir"}},
+		{DedupeRename, false,
+			[]ActionOp{DedupeKept, DedupeRenamed, DedupeRenamed, DedupeKept, DedupeRenamed},
+			[]string{"a.txt", "a 2.txt", "a 3.txt", "dir", "dir 2"}},
+	}
+	for _, tt := range tests {
+		for _, dryRun := range []bool{true, false} {
+			f, d := newFakeDrive(t)
+			f.unsigned = tt.unsigned
+			ids := []string{
+				f.addDup("a", "txt", "same", t1, t1),
+				f.addDup("a", "txt", "same", t2, t3),
+				f.addDup("a", "txt", "larger", t3, t2),
+			}
+			for _, created := range []time.Time{t1, t2} {
+				id := f.add("root", "dir", "", true, "")
+				f.items["FOLDER::com.apple.CloudDocs::"+id].Created = created
+				ids = append(ids, "FOLDER::com.apple.CloudDocs::"+id)
+			}
+			root, err := d.Root()
+			if err != nil {
+				t.Fatal(err)
+			}
+			acts, err := Dedupe(root, DedupeOptions{Mode: tt.mode, DryRun: dryRun})
+			if err != nil {
+				t.Fatalf("mode %d: %v", tt.mode, err)
+			}
+			var want []Action
+			for i, op := range tt.ops {
+				path := "a.txt"
+				if i >= 3 {
+					path = "dir"
+				}
+				a := Action{Op: op, Path: path, ID: ids[i]}
+				if op == DedupeRenamed {
+					a.NewName = tt.names[i]
+				}
+				want = append(want, a)
+			}
+			if !reflect.DeepEqual(acts, want) {
+				t.Errorf("mode %d, unsigned %v, dry run %v: performed %v, want %v", tt.mode, tt.unsigned, dryRun, acts, want)
+			}
+			if dryRun {
+				if names, _ := root.Dir(); len(names) != 5 {
+					t.Errorf("mode %d: dry run changed drive: %v", tt.mode, names)
+				}
+				continue
+			}
+			var wantNames []string
+			for i, name := range tt.names {
+				if name != "" {
+					wantNames = append(wantNames, name)
+				} else if !f.trashed(ids[i]) {
+					t.Errorf("mode %d: %s not trashed", tt.mode, ids[i])
+				}
+			}
+			names, err := root.Dir()
+			sort.Strings(names)
+			sort.Strings(wantNames)
+			if err != nil || !reflect.DeepEqual(names, wantNames) {
+				t.Errorf("mode %d: root lists %v, %v, want %v", tt.mode, names, err, wantNames)
+			}
+		}
+	}
+}
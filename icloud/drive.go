@@ -2,19 +2,25 @@ package icloud
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"mime"
 	"mime/multipart"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ivandeex/go-icloud/icloud/api"
+	log "github.com/sirupsen/logrus"
 )
 
 // DriveService describes the Drive iCloud service
@@ -23,11 +29,19 @@ type DriveService struct {
 	svcRoot string
 	docRoot string
 	root    *DriveNode
+	journal *uploadJournal
+	cache   *metaCache
+
+	uploadLimit   *rateLimiter
+	downloadLimit *rateLimiter
+
+	foldCase bool     // compare names ignoring case
+	enc      Encoding // converts names into local names
 }
 
 // NewDrive returns new Drive service
 func NewDrive(c *Client) (d *DriveService, err error) {
-	d = &DriveService{c: c}
+	d = newDriveService(c)
 	if d.svcRoot, err = c.getWebserviceURL("drivews"); err != nil {
 		return nil, err
 	}
@@ -37,11 +51,30 @@ func NewDrive(c *Client) (d *DriveService, err error) {
 	return d, nil
 }
 
+// newDriveService returns drive service not connected to web services
+func newDriveService(c *Client) *DriveService {
+	return &DriveService{
+		c:       c,
+		journal: newUploadJournal(c.dataPath("uploads.json")),
+
+		uploadLimit:   newRateLimiter(0),
+		downloadLimit: newRateLimiter(0),
+
+		enc: EncodeDefault,
+	}
+}
+
+// SetCaseInsensitive makes name lookups ignore letter case like iCloud does
+// when it detects name conflicts
+func (d *DriveService) SetCaseInsensitive(on bool) {
+	d.foldCase = on
+}
+
 // Root returns root folder
 func (d *DriveService) Root() (*DriveNode, error) {
 	root := d.root
 	if root == nil {
-		item, err := d.getNodeData("root")
+		item, err := d.listFolder("root", rootDriveID, "")
 		if err != nil {
 			return nil, err
 		}
@@ -49,20 +82,67 @@ func (d *DriveService) Root() (*DriveNode, error) {
 			d:     d,
 			i:     item,
 			ready: true,
+			items: item.Items,
 		}
 		d.root = root
 	}
 	return root, nil
 }
 
+// Lookup returns node by slash-separated path from the root folder
+func (d *DriveService) Lookup(path string) (*DriveNode, error) {
+	node, err := d.Root()
+	for _, name := range strings.Split(path, "/") {
+		if err != nil {
+			break
+		}
+		if name != "" && name != "." {
+			node, err = node.Get(name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return node, nil
+}
+
+// rootDriveID is the drivews id of the root folder
+const rootDriveID = "FOLDER::com.apple.CloudDocs::root"
+
+// listFolder returns folder details from metadata cache or server
+func (d *DriveService) listFolder(docID, driveID, etag string) (*api.DriveItem, error) {
+	if item := d.cache.lookup(driveID, etag); item != nil {
+		return item, nil
+	}
+	if d.cache.offline() {
+		return nil, fmt.Errorf("%s: %w", driveID, ErrOffline)
+	}
+	item, err := d.getNodeData(docID)
+	if err != nil {
+		return nil, err
+	}
+	d.cache.store(item)
+	return item, nil
+}
+
 // getNodeData returns node data
 func (d *DriveService) getNodeData(nodeID string) (*api.DriveItem, error) {
+	return d.getItemDetails("FOLDER::com.apple.CloudDocs::" + nodeID)
+}
+
+// getItemDetails returns folder details by drivews id, it does not work for files
+func (d *DriveService) getItemDetails(driveID string) (*api.DriveItem, error) {
+	return d.getItemDetailsContext(context.Background(), driveID)
+}
+
+// getItemDetailsContext is getItemDetails canceled with context
+func (d *DriveService) getItemDetailsContext(ctx context.Context, driveID string) (*api.DriveItem, error) {
 	folder := dict{
-		"drivewsid":   "FOLDER::com.apple.CloudDocs::" + nodeID,
+		"drivewsid":   driveID,
 		"partialData": false,
 	}
 	var res []api.DriveItem
-	if err := d.c.post(d.svcRoot+"/retrieveItemDetailsInFolders", []dict{folder}, nil, &res); err != nil {
+	if err := d.c.postContext(ctx, d.svcRoot+"/retrieveItemDetailsInFolders", []dict{folder}, nil, &res); err != nil {
 		return nil, err
 	}
 	if len(res) == 0 {
@@ -73,18 +153,37 @@ func (d *DriveService) getNodeData(nodeID string) (*api.DriveItem, error) {
 
 // DriveNode ...
 type DriveNode struct {
-	d     *DriveService
-	i     *api.DriveItem
-	ready bool
+	d      *DriveService
+	i      *api.DriveItem
+	parent *DriveNode
+	mu     sync.Mutex // guards children cache and signature
+	ready  bool
+	items  []*api.DriveItem
+	etag   string // etag of cached children
+	sig    string // content signature seen in the last download token
 }
 
-// Name of node
+// Name of node including extension
 func (n *DriveNode) Name() string {
-	name, ext := n.i.Name, n.i.Ext
-	if name != "" && ext != "" {
-		name += "." + ext
+	return joinExt(n.i.Name, n.i.Ext)
+}
+
+// ID returns drivews id of node
+func (n *DriveNode) ID() string { return n.i.DriveID }
+
+// Etag of node, it changes with node contents
+func (n *DriveNode) Etag() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.etagLocked()
+}
+
+// etagLocked returns etag of node, caller must hold the lock
+func (n *DriveNode) etagLocked() string {
+	if n.etag != "" {
+		return n.etag
 	}
-	return name
+	return n.i.Etag
 }
 
 // Size of node
@@ -110,9 +209,57 @@ func (n *DriveNode) Modified() time.Time { return n.i.Modified }
 // LastOpened time of node
 func (n *DriveNode) LastOpened() time.Time { return n.i.LastOpened }
 
+// ModTime returns modification time, implements fs.FileInfo
+func (n *DriveNode) ModTime() time.Time {
+	if n.i.Modified.IsZero() {
+		return n.i.Changed
+	}
+	return n.i.Modified
+}
+
+// Mode returns file mode bits, implements fs.FileInfo
+func (n *DriveNode) Mode() fs.FileMode {
+	if n.IsDir() {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// Sys returns underlying drive item, implements fs.FileInfo
+func (n *DriveNode) Sys() interface{} { return n.i }
+
+// Signature returns content signature of a file
+func (n *DriveNode) Signature() (string, error) {
+	if n.IsDir() {
+		return "", ErrNotFile
+	}
+	n.mu.Lock()
+	sig := n.sig
+	n.mu.Unlock()
+	if sig == "" && n.Size() > 0 {
+		token, err := n.d.getDownloadToken(context.Background(), n.i.DocID)
+		if err != nil {
+			return "", err
+		}
+		sig = token.Signature
+		n.setSignature(sig)
+	}
+	return sig, nil
+}
+
+// setSignature remembers content signature of a file
+func (n *DriveNode) setSignature(sig string) {
+	n.mu.Lock()
+	n.sig = sig
+	n.mu.Unlock()
+}
+
 // Stale forces node refresh
 func (n *DriveNode) Stale() {
+	n.mu.Lock()
 	n.ready = false
+	n.mu.Unlock()
+	n.d.cache.invalidate(n.i.DriveID)
 }
 
 // Children of node
@@ -120,24 +267,108 @@ func (n *DriveNode) Children() ([]*DriveNode, error) {
 	if !n.IsDir() {
 		return nil, ErrNotDir
 	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	if !n.ready {
-		item, err := n.d.getNodeData(n.i.DocID)
+		item, err := n.d.listFolder(n.i.DocID, n.i.DriveID, n.etagLocked())
 		if err != nil {
 			return nil, err
 		}
-		n.i.Items = item.Items
+		n.items, n.etag = item.Items, item.Etag
 		n.ready = true
 	}
 	children := []*DriveNode{}
-	for _, item := range n.i.Items {
-		children = append(children, &DriveNode{
-			d: n.d,
-			i: item,
-		})
+	for _, item := range n.items {
+		children = append(children, n.child(item))
 	}
 	return children, nil
 }
 
+// Parent returns parent folder, it's nil for root and trashed nodes
+func (n *DriveNode) Parent() *DriveNode { return n.parent }
+
+// putChild adds or replaces an item in cached children of a folder
+func (n *DriveNode) putChild(item *api.DriveItem) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.ready {
+		n.d.cache.invalidate(n.i.DriveID)
+		return
+	}
+	items := make([]*api.DriveItem, 0, len(n.items)+1)
+	found := false
+	for _, child := range n.items {
+		if child.DriveID == item.DriveID {
+			child, found = item, true
+		}
+		items = append(items, child)
+	}
+	if !found {
+		items = append(items, item)
+	}
+	n.items = items
+	n.d.cache.store(n.listing())
+}
+
+// dropChild removes an item from cached children of a folder
+func (n *DriveNode) dropChild(driveID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.ready {
+		n.d.cache.invalidate(n.i.DriveID)
+		return
+	}
+	items := make([]*api.DriveItem, 0, len(n.items))
+	for _, child := range n.items {
+		if child.DriveID != driveID {
+			items = append(items, child)
+		}
+	}
+	n.items = items
+	n.d.cache.store(n.listing())
+}
+
+// listing returns folder item with cached children, caller must hold the lock.
+// Children are kept in the node rather than its item, which is shared
+// with cached listing of the parent and never modified.
+// The listing is patched after a mutation which changed folder etag
+// on the server, so it has no etag: lookups by a known etag fetch
+// the folder again, others trust the listing until TTL.
+func (n *DriveNode) listing() *api.DriveItem {
+	item := *n.i
+	item.Items, item.Etag = n.items, ""
+	return &item
+}
+
+// update refreshes node attributes from server response keeping its children.
+// It replaces the item, attach puts it into parent listing. Node must not be
+// used concurrently with its own mutations.
+func (n *DriveNode) update(item *api.DriveItem) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	fresh := *item
+	fresh.Items = nil
+	n.i, n.etag = &fresh, ""
+}
+
+// attach adds node to cached children of its parent
+func (n *DriveNode) attach() {
+	if n.parent != nil {
+		n.parent.putChild(n.i)
+	} else {
+		n.d.cache.invalidate(n.i.ParentID)
+	}
+}
+
+// detach removes node from cached children of its parent
+func (n *DriveNode) detach() {
+	if n.parent != nil {
+		n.parent.dropChild(n.i.DriveID)
+	} else {
+		n.d.cache.invalidate(n.i.ParentID)
+	}
+}
+
 func (n *DriveNode) Dir() ([]string, error) {
 	children, err := n.Children()
 	if err != nil {
@@ -150,132 +381,484 @@ func (n *DriveNode) Dir() ([]string, error) {
 	return names, nil
 }
 
+// Get returns the first child with given name
 func (n *DriveNode) Get(name string) (*DriveNode, error) {
+	found, err := n.GetAll(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrNotFound
+	}
+	return found[0], nil
+}
+
+// GetAll returns all children with given name, iCloud allows duplicates
+func (n *DriveNode) GetAll(name string) ([]*DriveNode, error) {
 	children, err := n.Children()
 	if err != nil {
 		return nil, err
 	}
+	key := n.d.nameKey(name)
+	found := []*DriveNode{}
 	for _, child := range children {
-		if child.Name() == name {
-			return child, nil
+		if n.d.nameKey(child.Name()) == key {
+			found = append(found, child)
 		}
 	}
-	return nil, ErrNotFound
+	return found, nil
 }
 
 // Open file for reading
 func (n *DriveNode) Open() (io.ReadCloser, error) {
+	return n.open(context.Background())
+}
+
+// open opens file for reading, requests are canceled with context
+func (n *DriveNode) open(ctx context.Context) (io.ReadCloser, error) {
 	if n.IsDir() {
 		return nil, ErrNotFile
 	}
-	if n.Size() <= 0 {
+	if n.Size() == 0 {
 		// iCloud returns 400 Bad Request for empty files
 		return io.NopCloser(&bytes.Buffer{}), nil
 	}
-	return n.d.getFile(n.i.DocID)
+	fileURL, err := n.downloadURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := n.d.getFileRange(ctx, fileURL, 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from id %q: %w", n.i.DocID, err)
+	}
+	return stream, nil
 }
 
-// getFile returns an iCloud Drive file
-func (d *DriveService) getFile(fileID string) (io.ReadCloser, error) {
+// downloadURL returns signed download url of a file
+// and remembers its content signature
+func (n *DriveNode) downloadURL(ctx context.Context) (string, error) {
+	token, err := n.d.getDownloadToken(ctx, n.i.DocID)
+	if err != nil {
+		return "", err
+	}
+	n.setSignature(token.Signature)
+	return token.URL, nil
+}
+
+// getDownloadToken returns download token of a file
+func (d *DriveService) getDownloadToken(ctx context.Context, fileID string) (*api.DriveDataToken, error) {
 	var docResult *api.DriveDocResult
 	docURL := d.docRoot + "/ws/com.apple.CloudDocs/download/by_id?document_id=" + fileID
-	if err := d.c.get(docURL, &docResult); err != nil {
+	if err := d.c.getContext(ctx, docURL, &docResult); err != nil {
 		return nil, fmt.Errorf("cannot get download url for id %q: %w", fileID, err)
 	}
-	var fileURL string
-	if docResult != nil {
-		fileURL = docResult.DataToken.URL
-	}
-	if fileURL == "" {
+	if docResult == nil || docResult.DataToken.URL == "" {
 		return nil, errors.New("failed to get file url")
 	}
-	var stream io.ReadCloser
-	if err := d.c.get(fileURL, &stream); err != nil {
-		return nil, fmt.Errorf("failed to download from id %q: %w", fileID, err)
-	}
-	return stream, nil
+	return &docResult.DataToken, nil
 }
 
-// Download node into local file
-func (n *DriveNode) Download(path string) error {
-	in, err := n.Open()
+// getFileRange returns a part of file from the download url.
+// Negative end means the rest of file.
+func (d *DriveService) getFileRange(ctx context.Context, fileURL string, start, end int64) (io.ReadCloser, error) {
+	var (
+		stream io.ReadCloser
+		err    error
+	)
+	if start == 0 && end < 0 {
+		err = d.c.getContext(ctx, fileURL, &stream)
+	} else {
+		rng := fmt.Sprintf("bytes=%d-", start)
+		if end >= 0 {
+			rng += strconv.FormatInt(end, 10)
+		}
+		_, err = d.c.request(ctx, http.MethodGet, fileURL, nil, dict{"Range": rng}, &stream, false)
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return &limitedReadCloser{limitReader(stream, d.downloadLimit), stream}, nil
+}
+
+// downloadRetries is how many times a download is resumed without progress
+const downloadRetries = 3
+
+// Download node into local file.
+// Data is saved in a temporary file which is renamed on completion.
+// Interrupted transfers are resumed from the last received byte.
+func (n *DriveNode) Download(path string, opts ...TransferOption) error {
+	if n.IsDir() {
+		return ErrNotFile
 	}
-	defer func() { _ = in.Close() }()
-	out, err := os.Create(path)
+	out, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.partial")
 	if err != nil {
 		return fmt.Errorf("%s: cannot create file: %w", path, err)
 	}
-	_, err = io.Copy(out, in)
+	tmpPath := out.Name()
+	if err = out.Chmod(0o644); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	o := newTransferOptions(opts)
+	meter := newProgressMeter(o.progress, n.Name(), n.Size())
+	meter.phase(PhaseRequest)
+
+	var offset int64
+	sum := NewSignatureHash()
+	dst := io.MultiWriter(out, sum, meter)
+	for retry := 0; ; retry++ {
+		var (
+			in       io.ReadCloser
+			received int64
+		)
+		in, err = n.openAt(o.requestContext(), offset)
+		if err == nil {
+			meter.phase(PhaseDownload)
+			received, err = io.Copy(dst, o.contextReader(limitReader(in, o.limit)))
+			_ = in.Close()
+		}
+		offset += received
+		if err == nil && offset < n.Size() {
+			err = io.ErrUnexpectedEOF
+		}
+		if received > 0 {
+			retry = 0
+		}
+		if err == nil || retry >= downloadRetries || !isTransient(err) {
+			break
+		}
+		log.Debugf("%s: download interrupted at %d bytes, resuming: %v", n.Name(), offset, err)
+		select {
+		case <-time.After(time.Duration(retry+1) * time.Second):
+		case <-o.requestContext().Done():
+		}
+	}
+
 	errClose := out.Close()
 	if err == nil {
 		err = errClose
 	}
+	if err == nil && offset != n.Size() {
+		err = fmt.Errorf("%s: size mismatch: got %d bytes, want %d", path, offset, n.Size())
+	}
+	if err == nil && offset > 0 {
+		var sig string
+		if sig, err = n.Signature(); err == nil {
+			err = o.checked(verifySignature(path, sig, sum))
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	} else {
+		meter.phase(PhaseDone)
+	}
 	return err
 }
 
-// Upload new file to a folder
-func (n *DriveNode) Upload(path string) error {
+// Upload new file to a folder and return its node.
+// Local file name is converted into drive name, see SetEncoding.
+func (n *DriveNode) Upload(path string, opts ...TransferOption) (*DriveNode, error) {
 	f, err := os.Open(path)
-	var fi os.FileInfo
-	if err == nil {
-		fi, err = f.Stat()
+	if err != nil {
+		return nil, err
 	}
-	if err == nil {
-		err = n.PutStream(f, path, fi.Size(), fi.ModTime())
+	defer func() { _ = f.Close() }()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
 	}
-	return err
+	return n.PutStream(f, n.d.RemoteName(filepath.Base(path)), fi.Size(), fi.ModTime(), opts...)
 }
 
-// PutStream uploads a file stream to a folder
-func (n *DriveNode) PutStream(in io.Reader, path string, size int64, mtime time.Time) error {
+// PutStream uploads a file stream to a folder.
+// By default a conflicting copy is created if file name already exists,
+// use OnConflict option to change this.
+// Name must not contain "/", such names are rejected with ErrInvalidName.
+// It returns node of the uploaded file.
+func (n *DriveNode) PutStream(in io.Reader, name string, size int64, mtime time.Time, opts ...TransferOption) (*DriveNode, error) {
 	if !n.IsDir() {
-		return ErrNotDir
+		return nil, ErrNotDir
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	o := newTransferOptions(opts)
+	if o.conflict != ConflictKeepBoth {
+		existing, err := n.Get(name)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			// no conflict
+		case err != nil:
+			return nil, err
+		case o.conflict == ConflictFail:
+			return nil, fmt.Errorf("%s: %w", name, ErrExists)
+		case o.conflict == ConflictSkip:
+			return existing, nil
+		case o.conflict == ConflictUpdate && existing.Size() == size && sameTime(mtime, existing.Modified()):
+			return existing, nil
+		case o.conflict == ConflictOverwrite || o.conflict == ConflictUpdate:
+			if err = existing.Update(in, size, mtime, opts...); err != nil {
+				return nil, err
+			}
+			return existing, nil
+		case o.conflict == ConflictRename:
+			if name, err = n.uniqueName(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	doc, err := n.d.sendFile(n.i.DocID, "", in, name, size, mtime, o)
+	if err != nil {
+		n.Stale() // upload might have partially succeeded
+		return nil, err
+	}
+	item, err := n.d.committedItem(api.DriveItem{ParentID: n.i.DriveID}, doc)
+	if err != nil {
+		n.Stale()
+		return nil, err
+	}
+	n.putChild(item)
+	return n.child(item), nil
+}
+
+// child returns node of a child item
+func (n *DriveNode) child(item *api.DriveItem) *DriveNode {
+	return &DriveNode{d: n.d, i: item, parent: n}
+}
+
+// Update replaces file content keeping its id and sharing
+func (n *DriveNode) Update(in io.Reader, size int64, mtime time.Time, opts ...TransferOption) error {
+	if n.IsDir() {
+		return ErrNotFile
 	}
-	err := n.d.sendFile(n.i.DocID, in, path, size, mtime)
-	n.ready = false // force refresh
+	folderID := docIDFromDriveID(n.i.ParentID)
+	doc, err := n.d.sendFile(folderID, n.i.DocID, in, n.Name(), size, mtime, newTransferOptions(opts))
+	if err == nil {
+		n.mu.Lock()
+		base := *n.i
+		n.mu.Unlock()
+		base.Items = nil
+		var item *api.DriveItem
+		if item, err = n.d.committedItem(base, doc); err == nil {
+			n.update(item)
+			n.setSignature("")
+			n.attach()
+			return nil
+		}
+	}
+	n.staleParent()
 	return err
 }
 
-// sendFile sends new file to iCloud Drive
-func (d *DriveService) sendFile(folderID string, in io.Reader, path string, size int64, mtime time.Time) error {
-	name := filepath.Base(path)
-	mimeType := mime.TypeByExtension(filepath.Ext(name))
-	docID, contentURL, err := d.getUploadContentWsURL(name, mimeType, size)
+// committedItem returns drive item of an uploaded document based on given item.
+// If server has reported only document id, the item is found by id
+// in a fresh listing of the folder.
+func (d *DriveService) committedItem(base api.DriveItem, doc *api.DriveDocument) (*api.DriveItem, error) {
+	if doc.Etag == "" {
+		return d.findChild(base.ParentID, func(item *api.DriveItem) bool { return item.DocID == doc.DocID })
+	}
+	mergeDocument(&base, doc)
+	return &base, nil
+}
+
+// mergeDocument updates drive item with docws document attributes
+func mergeDocument(item *api.DriveItem, doc *api.DriveDocument) {
+	zone := doc.Zone
+	if zone == "" {
+		zone = "com.apple.CloudDocs"
+	}
+	size := doc.Size
+	item.DocID = doc.DocID
+	item.DriveID = "FILE::" + zone + "::" + doc.DocID
+	item.Zone = zone
+	item.Type = "FILE"
+	item.Name = doc.Name
+	item.Ext = doc.Ext
+	item.Size = &size
+	item.Etag = doc.Etag
+	if doc.Mtime != 0 {
+		item.Modified = time.UnixMilli(doc.Mtime).UTC()
+	}
+	item.Changed = time.Now().UTC()
+	if item.Created.IsZero() {
+		item.Created = item.Changed
+	}
+}
+
+// uniqueName returns a name not used in the folder, like "file 2.txt"
+func (n *DriveNode) uniqueName(name string) (string, error) {
+	names, err := n.Dir()
 	if err != nil {
-		return err
+		return "", err
+	}
+	used := map[string]bool{}
+	for _, name := range names {
+		used[n.d.nameKey(name)] = true
 	}
+	return n.d.freeName(name, used), nil
+}
 
-	// Prepare multipart body
-	body := &bytes.Buffer{}
-	mpWriter := multipart.NewWriter(body)
-	partWriter, err := mpWriter.CreateFormFile(name, name)
-	if err == nil {
-		_, err = io.Copy(partWriter, in)
+// freeName returns a name like "file 2.txt" not present in used names
+// and marks it as used
+func (d *DriveService) freeName(name string, used map[string]bool) string {
+	base, ext := splitExt(name)
+	for i := 2; used[d.nameKey(name)]; i++ {
+		name = joinExt(fmt.Sprintf("%s %d", base, i), ext)
 	}
-	if errClose := mpWriter.Close(); err == nil {
-		err = errClose
+	used[d.nameKey(name)] = true
+	return name
+}
+
+// docIDFromDriveID returns docws id of an item given its drivews id
+func docIDFromDriveID(driveID string) string {
+	if pos := strings.LastIndex(driveID, "::"); pos >= 0 {
+		return driveID[pos+2:]
 	}
+	return driveID
+}
+
+// sendFile sends file to iCloud Drive.
+// New document is created unless docID of existing file is given.
+// Progress of seekable uploads is kept in the journal so that an interrupted
+// upload can reuse its content url or only commit already accepted content.
+// Journal entries are keyed by size and modification time, and content
+// signature is checked before committing content accepted earlier,
+// so changed content is never committed by mistake.
+// It returns the resulting document, which has only DocID
+// if server does not report it.
+func (d *DriveService) sendFile(folderID, docID string, in io.Reader, name string, size int64, mtime time.Time, o *transferOptions) (*api.DriveDocument, error) {
 	if closer, canClose := in.(io.ReadCloser); canClose {
-		if errClose := closer.Close(); err == nil {
-			err = errClose
+		defer func() { _ = closer.Close() }()
+	}
+
+	meter := newProgressMeter(o.progress, name, size)
+	journal := d.journal
+	if !canRewind(in) {
+		journal = nil // stream content cannot be checked when resuming
+	}
+	key := uploadKey(folderID, name, size, mtime)
+	entry := journal.get(key)
+
+	if entry != nil && entry.Result != nil {
+		sig, err := contentSignature(in, size)
+		if err != nil {
+			return nil, err
+		}
+		if sig == entry.Signature {
+			log.Debugf("%s: content already uploaded, resuming commit", name)
+			return d.commitUpload(o.requestContext(), journal, key, folderID, entry, name, mtime, meter)
 		}
+		log.Debugf("%s: content changed since upload, starting afresh", name)
+		journal.remove(key)
+		entry = nil
 	}
-	if err != nil {
-		return err
+
+	resumed := entry != nil
+	if resumed {
+		log.Debugf("%s: resuming upload to %s", name, entry.DocID)
+	} else {
+		meter.phase(PhaseRequest)
+		mimeType := ""
+		if _, ext := splitExt(name); ext != "" {
+			mimeType = mime.TypeByExtension("." + ext)
+		}
+		newDocID, contentURL, err := d.getUploadContentWsURL(o.requestContext(), name, mimeType, size)
+		if err != nil {
+			return nil, err
+		}
+		entry = &uploadEntry{
+			DocID:      newDocID,
+			ContentURL: contentURL,
+			Started:    time.Now(),
+		}
+		if docID != "" {
+			entry.DocID = docID
+			entry.Replace = true
+		}
+		journal.put(key, entry)
 	}
 
-	hdr := dict{"Content-Type": mpWriter.FormDataContentType()}
+	meter.phase(PhaseUpload)
+	sum := NewSignatureHash()
+	src := o.contextReader(limitReader(in, d.uploadLimit, o.limit))
+	body, ctype, length := multipartBody(io.TeeReader(src, io.MultiWriter(sum, meter)), name, size)
+	defer func() { _ = body.Close() }()
+
+	hdr := dict{
+		"Content-Type":   ctype,
+		"Content-Length": strconv.FormatInt(length, 10),
+	}
 	var res *api.DriveUploadFileResult
-	if err := d.c.post(contentURL, body, hdr, &res); err != nil {
-		return err
+	if err := d.c.postContext(o.requestContext(), entry.ContentURL, body, hdr, &res); err != nil {
+		if resumed {
+			// content url has probably expired, start afresh next time
+			journal.remove(key)
+		}
+		return nil, err
 	}
-	return d.updateContentWs(folderID, res, docID, name, mtime)
+	if res == nil {
+		journal.remove(key)
+		return nil, errors.New("invalid upload result")
+	}
+	if err := o.checked(verifySignature(name, res.SingleFile.FileChecksum, sum)); err != nil {
+		journal.remove(key)
+		return nil, err
+	}
+	entry.Result = res
+	entry.Signature = EncodeSignature(sum)
+	journal.put(key, entry)
+	return d.commitUpload(o.requestContext(), journal, key, folderID, entry, name, mtime, meter)
+}
+
+// commitUpload updates document metadata and clears the journal entry
+func (d *DriveService) commitUpload(ctx context.Context, journal *uploadJournal, key, folderID string, entry *uploadEntry, name string, mtime time.Time, meter *progressMeter) (*api.DriveDocument, error) {
+	meter.phase(PhaseCommit)
+	doc, err := d.updateContentWs(ctx, folderID, entry.Result, entry.DocID, name, mtime, entry.Replace)
+	if err == nil {
+		journal.remove(key)
+		meter.phase(PhaseDone)
+	}
+	return doc, err
+}
+
+// multipartBody streams file contents as a multipart form.
+// It returns the body reader, its content type and total length.
+func multipartBody(in io.Reader, name string, size int64) (io.ReadCloser, string, int64) {
+	// Measure multipart framing with a fixed boundary
+	frame := &bytes.Buffer{}
+	mpWriter := multipart.NewWriter(frame)
+	boundary := mpWriter.Boundary()
+	_, _ = mpWriter.CreateFormFile(name, name)
+	_ = mpWriter.Close()
+	length := int64(frame.Len()) + size
+
+	pr, pw := io.Pipe()
+	go func() {
+		mpWriter := multipart.NewWriter(pw)
+		_ = mpWriter.SetBoundary(boundary)
+		partWriter, err := mpWriter.CreateFormFile(name, name)
+		if err == nil {
+			var n int64
+			n, err = io.Copy(partWriter, in)
+			if err == nil && n != size {
+				err = fmt.Errorf("%s: size changed from %d to %d bytes", name, size, n)
+			}
+		}
+		if errClose := mpWriter.Close(); err == nil {
+			err = errClose
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	return pr, mpWriter.FormDataContentType(), length
 }
 
 // getUploadContentWsURL returns the contentWS endpoint URL to add a new file
-func (d *DriveService) getUploadContentWsURL(name string, mimeType string, size int64) (string, string, error) {
+func (d *DriveService) getUploadContentWsURL(ctx context.Context, name string, mimeType string, size int64) (string, string, error) {
 	token := d.getTokenFromCookie()
 	if token == "" {
 		return "", "", errors.New("cannot obtain upload token")
@@ -294,7 +877,7 @@ func (d *DriveService) getUploadContentWsURL(name string, mimeType string, size
 		res           []api.DriveUploadContentWsResult
 		docID, docURL string
 	)
-	if err := d.c.post(url, data, hdr, &res); err != nil {
+	if err := d.c.postContext(ctx, url, data, hdr, &res); err != nil {
 		return "", "", err
 	}
 	if len(res) > 0 {
@@ -307,7 +890,9 @@ func (d *DriveService) getUploadContentWsURL(name string, mimeType string, size
 	return docID, docURL, nil
 }
 
-func (d *DriveService) updateContentWs(folderID string, uploadResult *api.DriveUploadFileResult, docID string, path string, mtime time.Time) error {
+// updateContentWs commits uploaded content as a new document
+// or as a new revision of existing document if replace is set
+func (d *DriveService) updateContentWs(ctx context.Context, folderID string, uploadResult *api.DriveUploadFileResult, docID string, path string, mtime time.Time, replace bool) (*api.DriveDocument, error) {
 	fi := &uploadResult.SingleFile
 	baseData := dict{
 		"signature":           fi.FileChecksum,
@@ -324,7 +909,7 @@ func (d *DriveService) updateContentWs(folderID string, uploadResult *api.DriveU
 			"starting_document_id": folderID,
 			"path":                 path,
 		},
-		"allow_conflict": true,
+		"allow_conflict": !replace,
 		"file_flags": dict{
 			"is_writable":   true,
 			"is_executable": false,
@@ -341,7 +926,19 @@ func (d *DriveService) updateContentWs(folderID string, uploadResult *api.DriveU
 
 	url := d.docRoot + "/ws/com.apple.CloudDocs/update/documents"
 	hdr := dict{"Content-Type": "text/plain"} // sic!
-	return d.c.post(url, data, hdr, nil)
+	var res api.DriveUpdateResult
+	if err := d.c.postContext(ctx, url, data, hdr, &res); err != nil {
+		return nil, err
+	}
+	for _, result := range res.Results {
+		if st := result.Status; st.Code != 0 {
+			return nil, NewErrAPI(st.Code, "", st.Error, false)
+		}
+		if result.Document != nil {
+			return result.Document, nil
+		}
+	}
+	return &api.DriveDocument{DocID: docID}, nil
 }
 
 // getTokenFromCookie returns the drive service token
@@ -361,12 +958,39 @@ func (d *DriveService) getTokenFromCookie() string {
 
 // Delete an iCloud Drive item
 func (n *DriveNode) Delete() error {
-	// TODO force parent refresh
-	return n.d.moveToTrash(n.i.DriveID, n.i.Etag)
+	item, err := n.d.moveToTrash(n.i.DriveID, n.Etag())
+	if err != nil {
+		n.staleParent() // etag might be outdated
+		return err
+	}
+	n.d.cache.invalidate(n.i.DriveID)
+	n.detach()
+	if item != nil {
+		n.update(item)
+	}
+	n.parent = nil
+	return nil
+}
+
+// staleParent forces refresh of parent folder
+func (n *DriveNode) staleParent() {
+	if n.parent != nil {
+		n.parent.Stale()
+	} else {
+		n.d.cache.invalidate(n.i.ParentID)
+	}
+}
+
+// firstItem returns the first item of mutation result or nil
+func firstItem(items []*api.DriveItem) *api.DriveItem {
+	if len(items) == 0 || items[0] == nil || items[0].DriveID == "" {
+		return nil
+	}
+	return items[0]
 }
 
 // moveToTrash moves items to trash bin
-func (d *DriveService) moveToTrash(nodeID, etag string) error {
+func (d *DriveService) moveToTrash(nodeID, etag string) (*api.DriveItem, error) {
 	nodeData := dict{
 		"drivewsid": nodeID,
 		"etag":      etag,
@@ -375,16 +999,69 @@ func (d *DriveService) moveToTrash(nodeID, etag string) error {
 	data := dict{
 		"items": []dict{nodeData},
 	}
-	return d.c.post(d.svcRoot+"/moveItemsToTrash", data, nil, nil)
+	var res api.DriveItemsResult
+	if err := d.c.post(d.svcRoot+"/moveItemsToTrash", data, nil, &res); err != nil {
+		return nil, err
+	}
+	return firstItem(res.Items), nil
 }
 
-// Mkdir creates new directory
-func (n *DriveNode) Mkdir(folder string) error {
-	n.ready = false // force parent refresh
-	return n.d.createFolders(n.i.DriveID, folder)
+// Mkdir creates new directory and returns its node
+func (n *DriveNode) Mkdir(folder string) (*DriveNode, error) {
+	if err := checkName(folder); err != nil {
+		return nil, err
+	}
+	item, err := n.d.createFolders(n.i.DriveID, folder)
+	if err != nil {
+		n.Stale()
+		return nil, err
+	}
+	if item == nil {
+		// no folder in response, find a new child of that name
+		known := map[string]bool{}
+		n.mu.Lock()
+		for _, child := range n.items {
+			known[child.DriveID] = true
+		}
+		n.mu.Unlock()
+		key := n.d.nameKey(folder)
+		item, err = n.d.findChild(n.i.DriveID, func(item *api.DriveItem) bool {
+			return !known[item.DriveID] && n.d.nameKey(joinExt(item.Name, item.Ext)) == key
+		})
+		n.Stale()
+		if err != nil {
+			return nil, err
+		}
+		return n.child(item), nil
+	}
+	n.putChild(item)
+	return n.child(item), nil
+}
+
+// findChild lists a folder bypassing cache and returns the only child
+// satisfying a condition
+func (d *DriveService) findChild(folderID string, match func(*api.DriveItem) bool) (*api.DriveItem, error) {
+	folder, err := d.getItemDetails(folderID)
+	if err != nil {
+		return nil, err
+	}
+	var found *api.DriveItem
+	for _, item := range folder.Items {
+		if !match(item) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("cannot tell result from %q and %q: %w", found.DriveID, item.DriveID, ErrExists)
+		}
+		found = item
+	}
+	if found == nil {
+		return nil, fmt.Errorf("result not found in %q: %w", folderID, ErrNotFound)
+	}
+	return found, nil
 }
 
-func (d *DriveService) createFolders(parent, name string) error {
+func (d *DriveService) createFolders(parent, name string) (*api.DriveItem, error) {
 	folder := dict{
 		"clientId": d.c.session.ClientID,
 		"name":     name,
@@ -394,22 +1071,92 @@ func (d *DriveService) createFolders(parent, name string) error {
 		"folders":              []dict{folder},
 	}
 	hdr := dict{"Content-Type": "text/plain"}
-	return d.c.post(d.svcRoot+"/createFolders", data, hdr, nil)
+	var res api.DriveFoldersResult
+	if err := d.c.post(d.svcRoot+"/createFolders", data, hdr, &res); err != nil {
+		return nil, err
+	}
+	return firstItem(res.Folders), nil
 }
 
-// Rename a node
-func (n *DriveNode) Rename(newName string) error {
-	// TODO force parent refresh
-	return n.d.renameItems(n.i.DriveID, n.i.Etag, newName)
+// Rename a node, it returns the node itself with updated attributes.
+// Extension of a file is changed along with the name.
+func (n *DriveNode) Rename(newName string) (*DriveNode, error) {
+	if err := checkName(newName); err != nil {
+		return nil, err
+	}
+	names := dict{"name": newName}
+	if !n.IsDir() || n.i.Ext != "" {
+		base, ext := splitExt(newName)
+		names = dict{"name": base, "extension": ext}
+	}
+	item, err := n.d.renameItems(n.i.DriveID, n.Etag(), names)
+	if err != nil {
+		n.staleParent()
+		return nil, err
+	}
+	if item == nil {
+		// renamed, but server has not reported the result
+		driveID := n.i.DriveID
+		item, err = n.d.findChild(n.i.ParentID, func(item *api.DriveItem) bool { return item.DriveID == driveID })
+		if err != nil {
+			n.staleParent()
+			return nil, err
+		}
+	}
+	n.update(item)
+	n.attach()
+	return n, nil
 }
 
-func (d *DriveService) renameItems(nodeID, etag, name string) error {
+func (d *DriveService) renameItems(nodeID, etag string, names dict) (*api.DriveItem, error) {
 	node := dict{
 		"drivewsid": nodeID,
-		"etag":      etag, "name": name,
+		"etag":      etag,
+	}
+	for key, val := range names {
+		node[key] = val
 	}
 	data := dict{
 		"items": []dict{node},
 	}
-	return d.c.post(d.svcRoot+"/renameItems", data, nil, nil)
+	var res api.DriveItemsResult
+	if err := d.c.post(d.svcRoot+"/renameItems", data, nil, &res); err != nil {
+		return nil, err
+	}
+	return firstItem(res.Items), nil
+}
+
+// Move a node into another folder
+func (n *DriveNode) Move(folder *DriveNode) error {
+	if !folder.IsDir() {
+		return ErrNotDir
+	}
+	item, err := n.d.moveItems(n.i.DriveID, n.Etag(), folder.i.DriveID)
+	if err != nil || item == nil {
+		n.staleParent()
+		folder.Stale()
+		return err
+	}
+	n.detach()
+	n.update(item)
+	n.parent = folder
+	n.attach()
+	return nil
+}
+
+func (d *DriveService) moveItems(nodeID, etag, destID string) (*api.DriveItem, error) {
+	node := dict{
+		"drivewsid": nodeID,
+		"etag":      etag,
+		"clientId":  d.c.session.ClientID,
+	}
+	data := dict{
+		"destinationDrivewsId": destID,
+		"items":                []dict{node},
+	}
+	var res api.DriveItemsResult
+	if err := d.c.post(d.svcRoot+"/moveItems", data, nil, &res); err != nil {
+		return nil, err
+	}
+	return firstItem(res.Items), nil
 }
@@ -0,0 +1,184 @@
+package icloud
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMutationsWithoutResults(t *testing.T) {
+	f, d := newFakeDrive(t)
+	f.add("root", "x", "txt", false, "old")
+	f.bare = true
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := root.Get("x.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// server keeps both files renaming the new one
+	node, err := root.PutStream(strings.NewReader("new"), "x.txt", 3, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.ID() == old.ID() || node.Name() != "x 2.txt" || node.Size() != 3 {
+		t.Fatalf("got node %s %q of size %d", node.ID(), node.Name(), node.Size())
+	}
+
+	if err = node.Update(strings.NewReader("newer"), 5, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if node.Size() != 5 {
+		t.Fatalf("updated size %d, want 5", node.Size())
+	}
+
+	renamed, err := old.Rename("y.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed != old || old.Name() != "y.md" {
+		t.Fatalf("renamed to %q", old.Name())
+	}
+
+	// known folder of the same name is not taken for the created one
+	other := f.add("root", "dir", "", true, "")
+	root.Stale()
+	if _, err = root.Children(); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := root.Mkdir("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dir.IsDir() || dir.Name() != "dir" || dir.ID() == "FOLDER::com.apple.CloudDocs::"+other {
+		t.Fatalf("created %s %s %q", dir.Type(), dir.ID(), dir.Name())
+	}
+
+	// folder created meanwhile by another client is ambiguous
+	if _, err = root.Children(); err != nil {
+		t.Fatal(err)
+	}
+	f.add("root", "new", "", true, "")
+	if _, err = root.Mkdir("new"); !errors.Is(err, ErrExists) {
+		t.Fatalf("ambiguous folder result: %v", err)
+	}
+}
+
+func TestUpdateKeepsParentListing(t *testing.T) {
+	f, d := newFakeDrive(t)
+	f.add("root", "a", "txt", false, "a")
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := root.Get("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := root.items[0]
+	done := make(chan struct{})
+	go func() {
+		// concurrent readers of parent listing, run with -race
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_, _ = root.Dir()
+		}
+	}()
+	if _, err = node.Rename("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if listed.Name != "a" {
+		t.Errorf("listed item was modified in place: %q", listed.Name)
+	}
+	if names, _ := root.Dir(); len(names) != 1 || names[0] != "b.txt" {
+		t.Errorf("parent lists %v", names)
+	}
+}
+
+func TestMultipartBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		size    int64
+		fail    bool
+	}{
+		{"a.txt", "hello", 5, false},
+		{"empty", "", 0, false},
+		{"会議 \"quoted\".txt", strings.Repeat("x", 100000), 100000, false},
+		{"short.txt", "abc", 4, true},
+	}
+	for _, tt := range tests {
+		body, ctype, length := multipartBody(strings.NewReader(tt.content), tt.name, tt.size)
+		data, err := io.ReadAll(body)
+		_ = body.Close()
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%q: size mismatch not reported", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", tt.name, err)
+		}
+		if int64(len(data)) != length {
+			t.Errorf("%q: body has %d bytes, announced %d", tt.name, len(data), length)
+		}
+		_, params, err := mime.ParseMediaType(ctype)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.name, err)
+		}
+		part, err := multipart.NewReader(strings.NewReader(string(data)), params["boundary"]).NextPart()
+		if err != nil {
+			t.Fatalf("%q: %v", tt.name, err)
+		}
+		content, err := io.ReadAll(part)
+		if err != nil || string(content) != tt.content || part.FileName() != tt.name {
+			t.Errorf("%q: part %q has %d bytes, %v", tt.name, part.FileName(), len(content), err)
+		}
+	}
+}
+
+func TestSignatureWhileReading(t *testing.T) {
+	f, d := newFakeDrive(t)
+	f.add("root", "a", "txt", false, "aaa")
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := root.Get("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Signature(strings.NewReader("aaa"))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if sig, err := node.Signature(); sig != want || err != nil {
+				t.Errorf("got signature %q, %v", sig, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			in, err := node.Open()
+			if err == nil {
+				_, err = io.Copy(io.Discard, in)
+				_ = in.Close()
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -1,9 +1,13 @@
 package icloud
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"strings"
+	"syscall"
 )
 
 type ErrApple error
@@ -52,4 +56,39 @@ var (
 	ErrNotFound          = NewErr("path not found")
 	ErrNotDir            = NewErr("path is not a directory")
 	ErrNotFile           = NewErr("path is not a file")
+	ErrNotRegular        = NewErr("not a regular file or directory")
+	ErrNoRange           = NewErr("server does not support range requests")
+	ErrChecksum          = NewErr("checksum mismatch")
+	ErrUnverifiable      = NewErr("checksum cannot be verified")
+	ErrExists            = NewErr("path already exists")
+	ErrNotEmpty          = NewErr("directory not empty")
+	ErrNotSupported      = NewErr("operation not supported")
+	ErrOffline           = NewErr("not available in offline cache")
+	ErrInvalidName       = NewErr("invalid file name")
 )
+
+// isTransient returns true if a failed request is worth retrying.
+// Only network failures, interrupted streams and server overload are.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr ErrAPI
+	if errors.As(err, &apiErr) {
+		code := apiErr.Code
+		return code == 408 || code == 429 || code >= 500
+	}
+	for _, transient := range []error{
+		io.ErrUnexpectedEOF, syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE,
+	} {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
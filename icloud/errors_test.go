@@ -0,0 +1,46 @@
+package icloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// timeoutError is a network timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{NewErrAPI(503, "Service Unavailable", "", false), true},
+		{NewErrAPI(429, "Too Many Requests", "", false), true},
+		{NewErrAPI(404, "Not Found", "", false), false},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{fmt.Errorf("get: %w", timeoutError{}), true},
+		{syscall.ECONNRESET, true},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{&os.PathError{Op: "write", Path: "f", Err: syscall.ENOSPC}, false},
+		{&os.PathError{Op: "read", Path: "f", Err: syscall.EIO}, false},
+		{ErrChecksum, false},
+		{ErrNotFound, false},
+		{errors.New("invalid character 'x' looking for beginning of value"), false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
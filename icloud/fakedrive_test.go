@@ -0,0 +1,292 @@
+package icloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ivandeex/go-icloud/icloud/api"
+)
+
+// fakeDrive emulates drivews and docws endpoints in memory
+type fakeDrive struct {
+	mu         sync.Mutex
+	srv        *httptest.Server
+	items      map[string]*api.DriveItem // by drivewsid
+	data       map[string]string         // by docwsid
+	pending    map[string]string
+	seq        int
+	calls      []string
+	bare       bool          // omit results of mutations like some server responses do
+	failCommit int           // number of document updates to fail
+	hang       bool          // never answer download requests
+	hangList   bool          // never answer folder listings
+	urlTTL     time.Duration // expiry of download urls, zero for none
+	gone       int           // number of file requests to reject as expired
+	unsigned   bool          // omit content signatures from download tokens
+}
+
+const rootID = "FOLDER::com.apple.CloudDocs::root"
+
+// newFakeDrive returns fake server and drive service connected to it
+func newFakeDrive(t *testing.T) (*fakeDrive, *DriveService) {
+	f := &fakeDrive{items: map[string]*api.DriveItem{}, data: map[string]string{}, pending: map[string]string{}}
+	f.items[rootID] = &api.DriveItem{Name: "root", Type: "FOLDER", DocID: "root", DriveID: rootID, Etag: "1"}
+	f.items["TRASH_ROOT"] = &api.DriveItem{Name: "trash", Type: "FOLDER", DocID: "trash", DriveID: "TRASH_ROOT", Etag: "1"}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+	hc := f.srv.Client()
+	hc.Jar, _ = cookiejar.New(nil)
+	u, _ := url.Parse("https://icloud.com")
+	hc.Jar.SetCookies(u, []*http.Cookie{{Name: "X-APPLE-WEBAUTH-VALIDATE", Value: "v=1:t=TOKEN"}})
+	c, _ := NewClientWithOptions(hc, "x", "y", "", filepath.Join(t.TempDir(), "s"), true, true)
+	d := newDriveService(c)
+	d.svcRoot, d.docRoot = f.srv.URL, f.srv.URL
+	d.enc = EncodeNone
+	return f, d
+}
+
+func (f *fakeDrive) nextID() string { f.seq++; return fmt.Sprintf("n%d", f.seq) }
+
+// add creates an item in a folder given by docws id
+func (f *fakeDrive) add(parent, name, ext string, dir bool, content string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := f.nextID()
+	typ, prefix := "FILE", "FILE::com.apple.CloudDocs::"
+	if dir {
+		typ, prefix = "FOLDER", "FOLDER::com.apple.CloudDocs::"
+	}
+	size := int64(len(content))
+	it := &api.DriveItem{Name: name, Ext: ext, Type: typ, DocID: id, DriveID: prefix + id, ParentID: "FOLDER::com.apple.CloudDocs::" + parent, Etag: "e" + id, Modified: time.Unix(1600000000, 0).UTC()}
+	if !dir {
+		it.Size = &size
+		f.data[id] = content
+	}
+	f.items[it.DriveID] = it
+	return id
+}
+
+// byDoc finds item by docws id
+func (f *fakeDrive) byDoc(docID string) *api.DriveItem {
+	for _, it := range f.items {
+		if it.DocID == docID {
+			return it
+		}
+	}
+	return nil
+}
+
+// find returns child of a folder by full name
+func (f *fakeDrive) find(parent, name string) *api.DriveItem {
+	for _, it := range f.items {
+		n := it.Name
+		if it.Ext != "" {
+			n += "." + it.Ext
+		}
+		if it.ParentID == parent && n == name {
+			return it
+		}
+	}
+	return nil
+}
+
+// serve handles drive api requests
+func (f *fakeDrive) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	hang, hangList := f.hang, f.hangList
+	f.mu.Unlock()
+	// read request before locking, uploaded content may come from this server
+	var body []byte
+	if strings.HasPrefix(r.URL.Path, "/content/") {
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		part, _ := mr.NextPart()
+		body, _ = io.ReadAll(part)
+	} else {
+		body, _ = io.ReadAll(r.Body)
+	}
+	// server notices canceled requests only after reading their body
+	if hang && strings.Contains(r.URL.Path, "/download/") ||
+		hangList && strings.HasSuffix(r.URL.Path, "/retrieveItemDetailsInFolders") {
+		<-r.Context().Done()
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.URL.Path)
+	var req map[string]interface{}
+	_ = json.Unmarshal(body, &req)
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	items := func() []map[string]interface{} {
+		res := []map[string]interface{}{}
+		for _, v := range req["items"].([]interface{}) {
+			res = append(res, v.(map[string]interface{}))
+		}
+		return res
+	}
+	switch p := r.URL.Path; {
+	case strings.HasSuffix(p, "/retrieveItemDetailsInFolders"):
+		var arr []map[string]interface{}
+		_ = json.Unmarshal(body, &arr)
+		id := arr[0]["drivewsid"].(string)
+		src := f.items[id]
+		if strings.HasPrefix(id, "FILE::") {
+			// like the real service, details of files are not available here
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if src == nil {
+			w.WriteHeader(404)
+			return
+		}
+		it := *src
+		it.Items = nil
+		for _, c := range f.items {
+			if c.ParentID == id {
+				cc := *c
+				it.Items = append(it.Items, &cc)
+			}
+		}
+		_ = enc.Encode([]api.DriveItem{it})
+	case strings.Contains(p, "/download/by_id"):
+		docID := r.URL.Query().Get("document_id")
+		sig, _ := Signature(strings.NewReader(f.data[docID]))
+		if f.unsigned {
+			sig = ""
+		}
+		fileURL := f.srv.URL + "/file/" + docID
+		if f.urlTTL != 0 {
+			fileURL += fmt.Sprintf("?e=%d", time.Now().Add(f.urlTTL).Unix())
+		}
+		fmt.Fprintf(w, `{"data_token":{"url":"%s","signature":"%s"}}`, fileURL, sig)
+	case strings.HasPrefix(p, "/file/") && f.gone > 0:
+		f.gone--
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusGone)
+	case strings.HasPrefix(p, "/file/"):
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(f.data[strings.TrimPrefix(p, "/file/")]))
+	case strings.HasSuffix(p, "/upload/web"):
+		id := f.nextID()
+		fmt.Fprintf(w, `[{"document_id":"%s","url":"%s/content/%s"}]`, id, f.srv.URL, id)
+	case strings.HasPrefix(p, "/content/"):
+		data := body
+		f.pending["r"+strings.TrimPrefix(p, "/content/")] = string(data)
+		sig, _ := Signature(strings.NewReader(string(data)))
+		fmt.Fprintf(w, `{"singleFile":{"fileChecksum":"%s","size":%d,"receipt":"r%s"}}`, sig, len(data), strings.TrimPrefix(p, "/content/"))
+	case strings.HasSuffix(p, "/update/documents") && f.failCommit > 0:
+		f.failCommit--
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case strings.HasSuffix(p, "/update/documents"):
+		docID := req["document_id"].(string)
+		data := req["data"].(map[string]interface{})
+		content := f.pending[data["receipt"].(string)]
+		pth := req["path"].(map[string]interface{})
+		folder := "FOLDER::com.apple.CloudDocs::" + pth["starting_document_id"].(string)
+		it := f.byDoc(docID)
+		size := int64(len(content))
+		mtime := time.UnixMilli(int64(req["mtime"].(float64))).UTC()
+		if it == nil {
+			name := pth["path"].(string)
+			if ex := f.find(folder, name); ex != nil && req["allow_conflict"] == true {
+				b, e := splitExt(name)
+				name = b + " 2"
+				if e != "" {
+					name += "." + e
+				}
+			}
+			n, e := splitExt(name)
+			it = &api.DriveItem{Name: n, Ext: e, Type: "FILE", DocID: docID, DriveID: "FILE::com.apple.CloudDocs::" + docID, ParentID: folder}
+			f.items[it.DriveID] = it
+		}
+		it.Size = &size
+		it.Modified = mtime
+		it.Etag = f.nextID()
+		f.data[docID] = content
+		if f.bare {
+			_ = enc.Encode(map[string]interface{}{"results": []interface{}{map[string]interface{}{"status": map[string]interface{}{"status_code": 0}}}})
+			return
+		}
+		_ = enc.Encode(map[string]interface{}{"results": []interface{}{map[string]interface{}{"status": map[string]interface{}{"status_code": 0}, "document": map[string]interface{}{"document_id": docID, "item_id": "i" + docID, "etag": it.Etag, "name": it.Name, "extension": it.Ext, "size": size, "parent_id": pth["starting_document_id"], "type": "FILE", "mtime": req["mtime"]}}}})
+	case strings.HasSuffix(p, "/createFolders"):
+		dest := req["destinationDrivewsId"].(string)
+		res := []api.DriveItem{}
+		for _, v := range req["folders"].([]interface{}) {
+			id := f.nextID()
+			it := &api.DriveItem{Name: v.(map[string]interface{})["name"].(string), Type: "FOLDER", DocID: id, DriveID: "FOLDER::com.apple.CloudDocs::" + id, ParentID: dest, Etag: "e" + id}
+			f.items[it.DriveID] = it
+			res = append(res, *it)
+		}
+		f.items[dest].Etag = f.nextID()
+		if f.bare {
+			res = nil
+		}
+		_ = enc.Encode(map[string]interface{}{"destinationDrivewsId": dest, "folders": res})
+	case strings.HasSuffix(p, "/renameItems"):
+		res := []api.DriveItem{}
+		for _, v := range items() {
+			it := f.items[v["drivewsid"].(string)]
+			it.Name = v["name"].(string)
+			if e, ok := v["extension"].(string); ok {
+				it.Ext = e
+			}
+			it.Etag = f.nextID()
+			res = append(res, *it)
+		}
+		if f.bare {
+			res = nil
+		}
+		_ = enc.Encode(map[string]interface{}{"items": res})
+	case strings.HasSuffix(p, "/moveItemsToTrash"), strings.HasSuffix(p, "/moveItems"):
+		res := []api.DriveItem{}
+		dest := "TRASH_ROOT"
+		if d, ok := req["destinationDrivewsId"].(string); ok {
+			dest = d
+		}
+		for _, v := range items() {
+			it := f.items[v["drivewsid"].(string)]
+			if dest == "TRASH_ROOT" {
+				it.RestorePath = it.ParentID
+			}
+			it.ParentID = dest
+			it.Etag = f.nextID()
+			res = append(res, *it)
+		}
+		_ = enc.Encode(map[string]interface{}{"items": res})
+	case strings.HasSuffix(p, "/putBackItemsFromTrash"):
+		res := []api.DriveItem{}
+		for _, v := range items() {
+			it := f.items[v["drivewsid"].(string)]
+			it.ParentID, it.RestorePath = it.RestorePath, ""
+			it.Etag = f.nextID()
+			res = append(res, *it)
+		}
+		if f.bare {
+			res = nil
+		}
+		_ = enc.Encode(map[string]interface{}{"items": res})
+	case strings.HasSuffix(p, "/deleteItems"):
+		for _, v := range items() {
+			id := v["drivewsid"].(string)
+			delete(f.data, f.items[id].DocID)
+			delete(f.items, id)
+		}
+		_ = enc.Encode(map[string]interface{}{"items": []interface{}{}})
+	default:
+		w.WriteHeader(404)
+	}
+}
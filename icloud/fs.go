@@ -0,0 +1,203 @@
+package icloud
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// DriveFS exposes a drive folder as read-only file system.
+// It implements fs.FS, fs.ReadDirFS, fs.StatFS and fs.SubFS.
+type DriveFS struct {
+	root *DriveNode
+}
+
+// NewFS returns file system rooted at a folder
+func NewFS(root *DriveNode) *DriveFS {
+	return &DriveFS{root: root}
+}
+
+// FS returns file system of the whole drive
+func (d *DriveService) FS() (*DriveFS, error) {
+	root, err := d.Root()
+	if err != nil {
+		return nil, err
+	}
+	return NewFS(root), nil
+}
+
+// lookup returns node by fs path
+func (f *DriveFS) lookup(op, name string) (*DriveNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	node := f.root
+	if name == "." {
+		return node, nil
+	}
+	for _, elem := range strings.Split(name, "/") {
+		var err error
+		if node, err = node.Get(elem); err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fsError(err)}
+		}
+	}
+	return node, nil
+}
+
+// fsError translates drive errors into fs errors
+func fsError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrNotDir):
+		return fs.ErrNotExist
+	case errors.Is(err, ErrExists):
+		return fs.ErrExist
+	}
+	return err
+}
+
+// Open implements fs.FS
+func (f *DriveFS) Open(name string) (fs.File, error) {
+	node, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file := &driveFile{node: node, name: name}
+	if !node.IsDir() {
+		if file.r, err = node.NewReader(); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return file, nil
+}
+
+// ReadDir implements fs.ReadDirFS, entries are sorted by name
+func (f *DriveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	node, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readDir(node)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fsError(err)}
+	}
+	return entries, nil
+}
+
+// Stat implements fs.StatFS
+func (f *DriveFS) Stat(name string) (fs.FileInfo, error) {
+	node, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// Sub implements fs.SubFS
+func (f *DriveFS) Sub(dir string) (fs.FS, error) {
+	node, err := f.lookup("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	if !node.IsDir() {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: ErrNotDir}
+	}
+	return NewFS(node), nil
+}
+
+// readDir returns folder entries sorted by name
+func readDir(node *DriveNode) ([]fs.DirEntry, error) {
+	children, err := node.Children()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, fs.FileInfoToDirEntry(child))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// driveFile is an open file or folder of DriveFS.
+// Files also implement io.Seeker and io.ReaderAt.
+type driveFile struct {
+	node    *DriveNode
+	name    string
+	r       *DriveReader
+	entries []fs.DirEntry
+	listed  bool
+}
+
+// Stat implements fs.File
+func (f *driveFile) Stat() (fs.FileInfo, error) { return f.node, nil }
+
+// Read implements fs.File
+func (f *driveFile) Read(p []byte) (int, error) {
+	if f.r == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: ErrNotFile}
+	}
+	return f.r.Read(p)
+}
+
+// Seek implements io.Seeker
+func (f *driveFile) Seek(offset int64, whence int) (int64, error) {
+	if f.r == nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: ErrNotFile}
+	}
+	return f.r.Seek(offset, whence)
+}
+
+// ReadAt implements io.ReaderAt
+func (f *driveFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.r == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: ErrNotFile}
+	}
+	return f.r.ReadAt(p, off)
+}
+
+// Close implements fs.File
+func (f *driveFile) Close() error {
+	if f.r == nil {
+		return nil
+	}
+	return f.r.Close()
+}
+
+// ReadDir implements fs.ReadDirFile
+func (f *driveFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !f.node.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: ErrNotDir}
+	}
+	if !f.listed {
+		entries, err := readDir(f.node)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fsError(err)}
+		}
+		f.entries, f.listed = entries, true
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.entries) {
+		count = len(f.entries)
+	}
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+// static check of implemented interfaces
+var (
+	_ fs.ReadDirFS   = (*DriveFS)(nil)
+	_ fs.StatFS      = (*DriveFS)(nil)
+	_ fs.SubFS       = (*DriveFS)(nil)
+	_ fs.ReadDirFile = (*driveFile)(nil)
+	_ fs.FileInfo    = (*DriveNode)(nil)
+)
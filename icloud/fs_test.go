@@ -0,0 +1,59 @@
+package icloud
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDriveFS(t *testing.T) {
+	f, d := newFakeDrive(t)
+	f.add("root", "a", "txt", false, "aaa")
+	f.add("root", "empty", "", false, "")
+	dirID := f.add("root", "d", "", true, "")
+	f.add(dirID, "b", "txt", false, "bbbb")
+	subID := f.add(dirID, "sub", "", true, "")
+	f.add(subID, "c", "bin", false, "ccccc")
+	fsys, err := d.FS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fstest.TestFS(fsys, "a.txt", "empty", "d/b.txt", "d/sub/c.bin"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDriveFSErrors(t *testing.T) {
+	f, d := newFakeDrive(t)
+	f.add("root", "a", "txt", false, "aaa")
+	fsys, err := d.FS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want error
+	}{
+		{"missing", fs.ErrNotExist},
+		{"a.txt/below", fs.ErrNotExist},
+		{"/a.txt", fs.ErrInvalid},
+		{"../a.txt", fs.ErrInvalid},
+	}
+	for _, tt := range tests {
+		fi, err := fsys.Stat(tt.name)
+		if fi != nil || !errors.Is(err, tt.want) {
+			t.Errorf("Stat(%q) = %v, %v, want %v", tt.name, fi, err, tt.want)
+		}
+		if _, err = fsys.Open(tt.name); !errors.Is(err, tt.want) {
+			t.Errorf("Open(%q) got %v, want %v", tt.name, err, tt.want)
+		}
+		if _, err = fsys.ReadDir(tt.name); !errors.Is(err, tt.want) {
+			t.Errorf("ReadDir(%q) got %v, want %v", tt.name, err, tt.want)
+		}
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) || pathErr.Path != tt.name {
+			t.Errorf("ReadDir(%q) got %v, want path error", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Package httpfs implements read-only HTTP file browser over iCloud Drive
+package httpfs
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ivandeex/go-icloud/icloud"
+	log "github.com/sirupsen/logrus"
+)
+
+// Share is a drive folder published under URL prefix
+type Share struct {
+	Prefix string          // URL prefix, empty means root
+	FS     *icloud.DriveFS // shared folder
+	Token  string          // access token, empty disables auth
+}
+
+// Handler serves directory indexes and file downloads of shares.
+// Directory index is HTML by default and JSON with "?format=json"
+// or "Accept: application/json".
+type Handler struct {
+	shares []*Share
+}
+
+// New returns handler for given shares
+func New(shares ...Share) *Handler {
+	h := &Handler{}
+	for i := range shares {
+		s := shares[i]
+		s.Prefix = strings.TrimRight(path.Clean("/"+s.Prefix), "/")
+		h.shares = append(h.shares, &s)
+	}
+	// longest prefix wins
+	sort.Slice(h.shares, func(i, j int) bool { return len(h.shares[i].Prefix) > len(h.shares[j].Prefix) })
+	return h
+}
+
+// Entry is a directory index item
+type Entry struct {
+	Name     string    `json:"name"`
+	Dir      bool      `json:"dir"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Etag     string    `json:"etag,omitempty"`
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// links must not carry the path to other sites
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	share, name := h.match(r.URL.Path)
+	if share == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !share.authorize(w, r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="icloud"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	info, err := share.FS.Stat(name)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			redirect(w, r, r.URL.Path+"/")
+			return
+		}
+		h.serveDir(w, r, share, name)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		redirect(w, r, strings.TrimRight(r.URL.Path, "/"))
+		return
+	}
+	h.serveFile(w, r, share, name, info)
+}
+
+// match finds share by URL path and returns fs path in it
+func (h *Handler) match(urlPath string) (*Share, string) {
+	urlPath = path.Clean("/" + urlPath)
+	for _, s := range h.shares {
+		if s.Prefix == "" || urlPath == s.Prefix || strings.HasPrefix(urlPath, s.Prefix+"/") {
+			name := strings.Trim(strings.TrimPrefix(urlPath, s.Prefix), "/")
+			if name == "" {
+				name = "."
+			}
+			return s, name
+		}
+	}
+	return nil, ""
+}
+
+// tokenCookie is name of the cookie keeping access token of the root share
+const tokenCookie = "icloud_token"
+
+// cookieName returns name of the token cookie. Cookie of the root share
+// is sent along with requests to other shares, so each share has its own.
+func (s *Share) cookieName() string {
+	if s.Prefix == "" {
+		return tokenCookie
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s.Prefix))
+	return fmt.Sprintf("%s_%08x", tokenCookie, h.Sum32())
+}
+
+// authorize checks bearer token, token cookie or "token" query parameter.
+// Token given in query is moved into a cookie, so links need not carry it.
+func (s *Share) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		if !s.valid(token) {
+			return false
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     s.cookieName(),
+			Value:    token,
+			Path:     s.Prefix + "/",
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if token := strings.TrimPrefix(auth, "Bearer "); token != auth {
+		return s.valid(token)
+	}
+	if cookie, err := r.Cookie(s.cookieName()); err == nil {
+		return s.valid(cookie.Value)
+	}
+	return false
+}
+
+// valid compares token with share token in constant time
+func (s *Share) valid(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// serveFile streams file contents honoring Range and If-Modified-Since
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, share *Share, name string, info fs.FileInfo) {
+	file, err := share.FS.Open(name)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	defer func() { _ = file.Close() }()
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "File is not seekable", http.StatusInternalServerError)
+		return
+	}
+
+	hdr := w.Header()
+	// avoid content sniffing which would cost an extra range request
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	hdr.Set("Content-Type", ctype)
+	var modified time.Time
+	if node, ok := info.(*icloud.DriveNode); ok {
+		modified = node.Modified()
+		if etag := node.Etag(); etag != "" {
+			hdr.Set("Etag", `"`+etag+`"`)
+		}
+	}
+	http.ServeContent(w, r, info.Name(), modified, content)
+}
+
+// serveDir renders directory index
+func (h *Handler) serveDir(w http.ResponseWriter, r *http.Request, share *Share, name string) {
+	dirEntries, err := share.FS.ReadDir(name)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	entries := make([]Entry, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		info, err := de.Info()
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		entry := Entry{Name: info.Name(), Dir: info.IsDir(), Size: info.Size(), Modified: info.ModTime()}
+		if node, ok := info.(*icloud.DriveNode); ok {
+			entry.Modified = node.Modified()
+			entry.Etag = node.Etag()
+		}
+		if entry.Dir {
+			entry.Size = 0
+		}
+		entries = append(entries, entry)
+	}
+
+	if wantJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodHead {
+			return
+		}
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			log.Debugf("json index %s: %v", r.URL.Path, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	data := struct {
+		Path    string
+		Parent  bool
+		Entries []Entry
+	}{
+		Path:    r.URL.Path,
+		Parent:  name != ".",
+		Entries: entries,
+	}
+	if err := indexTemplate.Execute(w, data); err != nil {
+		log.Debugf("html index %s: %v", r.URL.Path, err)
+	}
+}
+
+// wantJSON tells whether client asked for JSON index
+func wantJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// redirect sends client to another unescaped path keeping query string,
+// except token which is already kept in a cookie
+func redirect(w http.ResponseWriter, r *http.Request, target string) {
+	target = (&url.URL{Path: target}).EscapedPath()
+	query := r.URL.Query()
+	query.Del("token")
+	if len(query) != 0 {
+		target += "?" + query.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+// httpError translates drive errors into HTTP status
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.NotFound(w, r)
+	case errors.Is(err, fs.ErrInvalid):
+		http.Error(w, "Bad request", http.StatusBadRequest)
+	default:
+		log.Infof("%s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, "Bad gateway", http.StatusBadGateway)
+	}
+}
+
+// escapePath escapes a file name for use in relative link
+func escapePath(name string) string {
+	return (&url.URL{Path: name}).EscapedPath()
+}
+
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"escape": escapePath,
+	"size":   icloud.FormatSize,
+	"time":   func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+<style>
+body { font-family: sans-serif; }
+td { padding: 0 1em; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{if .Parent}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}{{if .Dir}}<tr><td><a href="./{{escape .Name}}/">{{.Name}}/</a></td><td class="size">-</td>{{else}}<tr><td><a href="./{{escape .Name}}">{{.Name}}</a></td><td class="size">{{size .Size}}</td>{{end}}<td>{{time .Modified}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
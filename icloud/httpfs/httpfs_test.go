@@ -0,0 +1,97 @@
+package httpfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	s := &Share{Prefix: "/docs", Token: "secret"}
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		cookie string
+		ok     bool
+	}{
+		{"none", "/docs/", "", "", false},
+		{"query", "/docs/?token=secret", "", "", true},
+		{"wrong query", "/docs/?token=guess", "", "", false},
+		{"bearer", "/docs/", "Bearer secret", "", true},
+		{"wrong bearer", "/docs/", "Bearer guess", "", false},
+		{"cookie", "/docs/", "", "secret", true},
+		{"wrong cookie", "/docs/", "", "guess", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: s.cookieName(), Value: tt.cookie})
+		}
+		w := httptest.NewRecorder()
+		if ok := s.authorize(w, r); ok != tt.ok {
+			t.Errorf("%s: authorized %v, want %v", tt.name, ok, tt.ok)
+		}
+		cookies := w.Result().Cookies()
+		if tt.name == "query" {
+			if len(cookies) != 1 || cookies[0].Value != "secret" || cookies[0].Path != "/docs/" || !cookies[0].HttpOnly {
+				t.Errorf("%s: cookies %v", tt.name, cookies)
+			}
+		} else if len(cookies) != 0 {
+			t.Errorf("%s: unexpected cookies %v", tt.name, cookies)
+		}
+	}
+}
+
+func TestShareCookies(t *testing.T) {
+	h := New(Share{Prefix: "", Token: "a"}, Share{Prefix: "docs", Token: "b"}, Share{Prefix: "/photos/", Token: "c"})
+	names := map[string]string{}
+	for _, s := range h.shares {
+		r := httptest.NewRequest(http.MethodGet, s.Prefix+"/?token="+s.Token, nil)
+		w := httptest.NewRecorder()
+		if !s.authorize(w, r) {
+			t.Fatalf("share %q did not accept its token", s.Prefix)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Path != s.Prefix+"/" {
+			t.Fatalf("share %q set cookies %v", s.Prefix, cookies)
+		}
+		if prev, dup := names[cookies[0].Name]; dup {
+			t.Errorf("shares %q and %q use cookie %s", prev, s.Prefix, cookies[0].Name)
+		}
+		names[cookies[0].Name] = s.Prefix
+	}
+
+	// browser sends cookie of the root share to other shares too
+	r := httptest.NewRequest(http.MethodGet, "/docs/", nil)
+	r.AddCookie(&http.Cookie{Name: h.shares[2].cookieName(), Value: "a"})
+	r.AddCookie(&http.Cookie{Name: h.shares[1].cookieName(), Value: "b"})
+	share, _ := h.match(r.URL.Path)
+	if !share.authorize(httptest.NewRecorder(), r) {
+		t.Error("share cookie was shadowed by root share cookie")
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		url    string
+		target string
+		want   string
+	}{
+		{"/docs/dir?token=secret&format=json", "/docs/dir/", "/docs/dir/?format=json"},
+		{"/docs/a%3Fb/c%23d", "/docs/a?b/c#d/", "/docs/a%3Fb/c%23d/"},
+		{"/docs/a%20b/c:d.txt/", "/docs/a b/c:d.txt", "/docs/a%20b/c:d.txt"},
+		{"/100%25/x", "/100%/x/", "/100%25/x/"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		w := httptest.NewRecorder()
+		redirect(w, r, tt.target)
+		if got := w.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s: redirected to %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
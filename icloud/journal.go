@@ -0,0 +1,141 @@
+package icloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ivandeex/go-icloud/icloud/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// uploadEntry keeps progress of a single upload.
+// Content service accepts a file only as a whole, so an interrupted
+// transfer is resent in full to the same content url, but content
+// accepted by the server is committed without sending it again
+// if local content still has the recorded signature.
+type uploadEntry struct {
+	DocID      string                     `json:"document_id"`
+	ContentURL string                     `json:"content_url"`
+	Replace    bool                       `json:"replace"`
+	Result     *api.DriveUploadFileResult `json:"result,omitempty"`
+	Signature  string                     `json:"signature,omitempty"`
+	Started    time.Time                  `json:"started"`
+}
+
+// uploadJournal persists progress of interrupted uploads.
+// Nil journal is valid and keeps nothing.
+type uploadJournal struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]*uploadEntry `json:"uploads"`
+}
+
+// uploadKey identifies an upload in the journal by destination, size and time.
+// It's cheap to build, content is checked only when an upload is resumed.
+func uploadKey(folderID, name string, size int64, mtime time.Time) string {
+	return fmt.Sprintf("%s/%s:%d:%d", folderID, name, size, mtime.UnixMilli())
+}
+
+// canRewind tells whether input can be read again, like a local file
+func canRewind(in io.Reader) bool {
+	rs, canSeek := in.(io.ReadSeeker)
+	if !canSeek {
+		return false
+	}
+	_, err := rs.Seek(0, io.SeekCurrent)
+	return err == nil // pipes have Seek but fail it
+}
+
+// contentSignature returns signature of seekable input rewinding it back
+func contentSignature(in io.Reader, size int64) (string, error) {
+	rs, canSeek := in.(io.ReadSeeker)
+	if !canSeek {
+		return "", errors.New("input cannot be rewound")
+	}
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	sig, err := Signature(io.LimitReader(rs, size))
+	if err != nil {
+		return "", err
+	}
+	if _, err = rs.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	return sig, nil
+}
+
+// newUploadJournal loads upload journal from a file.
+// Empty path disables persistence.
+func newUploadJournal(path string) *uploadJournal {
+	j := &uploadJournal{path: path, Entries: map[string]*uploadEntry{}}
+	if path == "" {
+		return j
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, j)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Debugf("Ignoring broken upload journal %s: %v", path, err)
+	}
+	if j.Entries == nil {
+		j.Entries = map[string]*uploadEntry{}
+	}
+	return j
+}
+
+// get returns a copy of journal entry or nil
+func (j *uploadJournal) get(key string) *uploadEntry {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if e := j.Entries[key]; e != nil {
+		entry := *e
+		return &entry
+	}
+	return nil
+}
+
+// put saves journal entry
+func (j *uploadJournal) put(key string, entry *uploadEntry) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e := *entry
+	j.Entries[key] = &e
+	j.save()
+}
+
+// remove drops journal entry
+func (j *uploadJournal) remove(key string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.Entries[key]; ok {
+		delete(j.Entries, key)
+		j.save()
+	}
+}
+
+// save writes journal on disk, errors are not fatal
+func (j *uploadJournal) save() {
+	if j.path == "" {
+		return
+	}
+	if err := os.WriteFile(j.path, Marshal(j), 0600); err != nil {
+		log.Debugf("Cannot save upload journal %s: %v", j.path, err)
+	}
+}
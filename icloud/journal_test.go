@@ -0,0 +1,164 @@
+package icloud
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uploads.json")
+	j := newUploadJournal(path)
+	key := uploadKey("folder", "a.txt", 1, time.Unix(1, 0))
+	j.put(key, &uploadEntry{DocID: "doc", ContentURL: "url"})
+
+	loaded := newUploadJournal(path)
+	entry := loaded.get(key)
+	if entry == nil || entry.DocID != "doc" || entry.ContentURL != "url" {
+		t.Fatalf("got %+v", entry)
+	}
+	entry.DocID = "changed"
+	if loaded.get(key).DocID != "doc" {
+		t.Error("journal entry was modified through a copy")
+	}
+	loaded.remove(key)
+	if newUploadJournal(path).get(key) != nil {
+		t.Error("removed entry was loaded")
+	}
+
+	var nilJournal *uploadJournal
+	nilJournal.put(key, entry)
+	if nilJournal.get(key) != nil {
+		t.Error("nil journal returned entry")
+	}
+	nilJournal.remove(key)
+}
+
+func TestUploadKey(t *testing.T) {
+	mtime := time.Unix(1, 0)
+	key := uploadKey("f", "a", 1, mtime)
+	if key == uploadKey("f", "a", 2, mtime) {
+		t.Error("uploads of different size have the same key")
+	}
+	if key == uploadKey("f", "a", 1, mtime.Add(time.Second)) {
+		t.Error("uploads of different time have the same key")
+	}
+}
+
+func TestContentSignature(t *testing.T) {
+	in := bytes.NewReader([]byte("skip content"))
+	if _, err := in.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := contentSignature(in, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Signature(strings.NewReader("content"))
+	if sig != want {
+		t.Errorf("got signature %s, want %s", sig, want)
+	}
+	if offset, _ := in.Seek(0, io.SeekCurrent); offset != 5 {
+		t.Errorf("input rewound to %d, want 5", offset)
+	}
+	if !canRewind(in) {
+		t.Error("seekable input cannot be rewound")
+	}
+	if canRewind(io.MultiReader(in)) {
+		t.Error("stream can be rewound")
+	}
+	if _, err = contentSignature(io.MultiReader(in), 7); err == nil {
+		t.Error("stream got signature")
+	}
+}
+
+// countingReader counts bytes read from a seekable input
+type countingReader struct {
+	*bytes.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestUploadReadsOnce(t *testing.T) {
+	_, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := &countingReader{Reader: bytes.NewReader([]byte("content"))}
+	if _, err = root.PutStream(in, "a.txt", 7, time.Unix(1600000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if in.n != 7 {
+		t.Errorf("read %d bytes, want 7", in.n)
+	}
+}
+
+// uploadAgain fails to commit the first upload of a file, then repeats it
+// and tells whether content was sent again
+func uploadAgain(t *testing.T, f *fakeDrive, root *DriveNode, path, content string) bool {
+	t.Helper()
+	mtime := time.Unix(1600000000, 0)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	f.calls = nil
+	node, err := root.Upload(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.data[node.i.DocID]; got != content {
+		t.Fatalf("uploaded %q, want %q", got, content)
+	}
+	for _, call := range f.calls {
+		if strings.HasPrefix(call, "/content/") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUploadResume(t *testing.T) {
+	f, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err = os.WriteFile(path, []byte("aaa"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Unix(1600000000, 0)
+	if err = os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	f.failCommit = 1
+	if _, err = root.Upload(path); err == nil {
+		t.Fatal("commit did not fail")
+	}
+	if uploadAgain(t, f, root, path, "aaa") {
+		t.Error("accepted content was sent again")
+	}
+
+	f.failCommit = 1
+	if _, err = root.Upload(path, OnConflict(ConflictOverwrite)); err == nil {
+		t.Fatal("commit did not fail")
+	}
+	// same size and time, but different content
+	if !uploadAgain(t, f, root, path, "bbb") {
+		t.Error("changed content was not sent")
+	}
+}
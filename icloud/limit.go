@@ -0,0 +1,117 @@
+package icloud
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// limitChunk is the largest read passed through a rate limiter at once,
+// smaller chunks make throttled streams smoother
+const limitChunk = 16 * 1024
+
+// rateLimiter throttles streams to a given rate in bytes per second.
+// It is safe for concurrent use, all streams share the same rate.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    int64
+	next    time.Time     // when the bytes passed so far are paid off
+	changed chan struct{} // closed and replaced when rate changes
+}
+
+// newRateLimiter returns limiter, zero rate means unlimited
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate, changed: make(chan struct{})}
+}
+
+// setRate changes the rate, zero rate means unlimited.
+// Bytes passed at the old rate but not paid off yet are rescaled
+// to the new rate, and waiting streams are woken up.
+func (l *rateLimiter) setRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.rate > 0 && rate > 0 && l.next.After(now) {
+		backlog := float64(l.next.Sub(now)) * float64(l.rate) / float64(rate)
+		l.next = now.Add(time.Duration(backlog))
+	} else {
+		l.next = time.Time{}
+	}
+	l.rate = rate
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// wait blocks until n bytes may pass or the rate changes
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+	changed := l.changed
+	l.mu.Unlock()
+	if delay <= 0 {
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-changed:
+	}
+}
+
+// limitedReader throttles reads through a set of limiters
+type limitedReader struct {
+	r        io.Reader
+	limiters []*rateLimiter
+}
+
+// limitReader returns reader throttled by limiters, nil limiters are skipped
+func limitReader(r io.Reader, limiters ...*rateLimiter) io.Reader {
+	lr := &limitedReader{r: r}
+	for _, l := range limiters {
+		if l != nil {
+			lr.limiters = append(lr.limiters, l)
+		}
+	}
+	if len(lr.limiters) == 0 {
+		return r
+	}
+	return lr
+}
+
+// Read implements io.Reader
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limitChunk {
+		p = p[:limitChunk]
+	}
+	n, err := lr.r.Read(p)
+	for _, l := range lr.limiters {
+		l.wait(n)
+	}
+	return n, err
+}
+
+// limitedReadCloser is a throttled io.ReadCloser
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// SetUploadLimit sets global upload rate in bytes per second, zero disables limit
+func (d *DriveService) SetUploadLimit(rate int64) {
+	d.uploadLimit.setRate(rate)
+}
+
+// SetDownloadLimit sets global download rate in bytes per second, zero disables limit
+func (d *DriveService) SetDownloadLimit(rate int64) {
+	d.downloadLimit.setRate(rate)
+}
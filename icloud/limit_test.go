@@ -0,0 +1,84 @@
+package icloud
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(100000)
+	start := time.Now()
+	for i := 0; i < 21; i++ {
+		l.wait(1000)
+	}
+	// the first chunk passes at once
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("20000 bytes at 100000 bytes/s took %v", elapsed)
+	}
+}
+
+func TestLimitReader(t *testing.T) {
+	in := bytes.NewReader(make([]byte, 3*limitChunk))
+	if r := limitReader(in, nil); r != io.Reader(in) {
+		t.Error("reader without limiters was wrapped")
+	}
+	r := limitReader(in, newRateLimiter(0), nil)
+	n, err := r.Read(make([]byte, 2*limitChunk))
+	if n != limitChunk || err != nil {
+		t.Errorf("read %d bytes, %v, want one chunk", n, err)
+	}
+}
+
+func TestRateLimiterSwitch(t *testing.T) {
+	tests := []struct {
+		name string
+		rate int64
+	}{
+		{"faster", 1 << 30},
+		{"unlimited", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(1000)
+			l.wait(10000) // ten seconds of backlog
+			done := make(chan struct{})
+			go func() {
+				l.wait(1)
+				close(done)
+			}()
+			time.Sleep(50 * time.Millisecond)
+			l.setRate(tt.rate)
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("waiting stream was not released")
+			}
+			start := time.Now()
+			l.wait(1000)
+			l.wait(1)
+			if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+				t.Errorf("backlog of slow rate delayed stream for %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterFromUnlimited(t *testing.T) {
+	l := newRateLimiter(0)
+	l.wait(1 << 20)
+	l.setRate(1000)
+	start := time.Now()
+	l.wait(10)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("first read after limiting waited %v", elapsed)
+	}
+	l.setRate(100)
+	start = time.Now()
+	l.wait(1)
+	// 10 bytes at 1000 bytes/s are 100ms at 100 bytes/s
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("rescaled backlog took %v, want 100ms", elapsed)
+	}
+}
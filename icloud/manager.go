@@ -0,0 +1,189 @@
+package icloud
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TransferJob is a queued upload or download
+type TransferJob struct {
+	Upload  bool             // true for upload, false for download
+	Node    *DriveNode       // target folder of upload or source file of download
+	Local   string           // local file path
+	Options []TransferOption // options of this transfer
+}
+
+// TransferResult is outcome of a single job
+type TransferResult struct {
+	Job      *TransferJob
+	Bytes    int64         // bytes transferred by the last attempt
+	Attempts int           // number of attempts made
+	Duration time.Duration // total time spent on the job
+	Err      error
+}
+
+// TransferStats aggregates results of all jobs
+type TransferStats struct {
+	Total    int
+	Done     int
+	Failed   int
+	Bytes    int64
+	Duration time.Duration
+}
+
+// TransferManager runs many uploads and downloads with bounded concurrency
+type TransferManager struct {
+	d           *DriveService
+	concurrency int
+	retries     int
+	mu          sync.Mutex
+	jobs        []*TransferJob
+}
+
+// NewTransferManager returns transfer manager running up to concurrency
+// transfers at once and retrying failed transfers given number of times
+func NewTransferManager(d *DriveService, concurrency, retries int) *TransferManager {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &TransferManager{
+		d:           d,
+		concurrency: concurrency,
+		retries:     retries,
+	}
+}
+
+// Upload queues upload of local file into a folder
+func (m *TransferManager) Upload(folder *DriveNode, local string, opts ...TransferOption) {
+	m.Add(&TransferJob{Upload: true, Node: folder, Local: local, Options: opts})
+}
+
+// Download queues download of a file into local path
+func (m *TransferManager) Download(file *DriveNode, local string, opts ...TransferOption) {
+	m.Add(&TransferJob{Node: file, Local: local, Options: opts})
+}
+
+// Add queues a job
+func (m *TransferManager) Add(job *TransferJob) {
+	m.mu.Lock()
+	m.jobs = append(m.jobs, job)
+	m.mu.Unlock()
+}
+
+// Run runs all queued jobs until done or context is canceled.
+// Optional callback receives results as jobs complete.
+// Results are returned in the order of jobs.
+func (m *TransferManager) Run(ctx context.Context, fn func(*TransferResult)) ([]*TransferResult, TransferStats) {
+	m.mu.Lock()
+	jobs := m.jobs
+	m.jobs = nil
+	m.mu.Unlock()
+
+	start := time.Now()
+	results := make([]*TransferResult, len(jobs))
+	queue := make(chan int)
+	var (
+		wg    sync.WaitGroup
+		fnMu  sync.Mutex
+		stats = TransferStats{Total: len(jobs)}
+	)
+	for w := 0; w < m.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				res := m.run(ctx, jobs[i])
+				results[i] = res
+				fnMu.Lock()
+				if res.Err == nil {
+					stats.Done++
+					stats.Bytes += res.Bytes
+				} else {
+					stats.Failed++
+				}
+				if fn != nil {
+					fn(res)
+				}
+				fnMu.Unlock()
+			}
+		}()
+	}
+
+	for i := range jobs {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			results[i] = &TransferResult{Job: jobs[i], Err: ctx.Err()}
+			fnMu.Lock()
+			stats.Failed++
+			if fn != nil {
+				fn(results[i])
+			}
+			fnMu.Unlock()
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	stats.Duration = time.Since(start)
+	return results, stats
+}
+
+// run performs a job with retries
+func (m *TransferManager) run(ctx context.Context, job *TransferJob) *TransferResult {
+	res := &TransferResult{Job: job}
+	start := time.Now()
+
+	// Count transferred bytes preserving caller's progress callback.
+	// Upload progress comes from another goroutine, which may outlive
+	// its attempt, so only the current attempt updates the result.
+	var (
+		mu      sync.Mutex
+		attempt int
+	)
+	userProgress := newTransferOptions(job.Options).progress
+	progress := func(current int) TransferOption {
+		return WithProgress(func(p Progress) {
+			mu.Lock()
+			if current == attempt {
+				res.Bytes = p.Bytes
+			}
+			mu.Unlock()
+			if userProgress != nil {
+				userProgress(p)
+			}
+		})
+	}
+
+	for {
+		mu.Lock()
+		attempt++
+		res.Attempts, res.Bytes = attempt, 0
+		mu.Unlock()
+		opts := append([]TransferOption{}, job.Options...)
+		opts = append(opts, WithContext(ctx), progress(attempt))
+		var err error
+		if job.Upload {
+			_, err = job.Node.Upload(job.Local, opts...)
+		} else {
+			err = job.Node.Download(job.Local, opts...)
+		}
+		if err == nil || attempt > m.retries || ctx.Err() != nil || !isTransient(err) {
+			mu.Lock()
+			res.Err = err
+			attempt = -1 // ignore late progress
+			mu.Unlock()
+			break
+		}
+		log.Debugf("%s: transfer failed, retrying: %v", job.Local, err)
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+		}
+	}
+	res.Duration = time.Since(start)
+	return res
+}
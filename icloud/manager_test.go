@@ -0,0 +1,66 @@
+package icloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransferManager(t *testing.T) {
+	_, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	m := NewTransferManager(d, 3, 1)
+	var total int64
+	for i := 0; i < 6; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("f%d.txt", i))
+		content := make([]byte, 1000*(i+1))
+		total += int64(len(content))
+		if err = os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m.Upload(root, path)
+	}
+	results, stats := m.Run(context.Background(), nil)
+	for _, res := range results {
+		if res.Err != nil {
+			t.Errorf("%s: %v", res.Job.Local, res.Err)
+		}
+	}
+	if stats.Done != 6 || stats.Failed != 0 || stats.Bytes != total {
+		t.Errorf("got stats %+v, want %d bytes", stats, total)
+	}
+}
+
+func TestTransferManagerCancelsRequests(t *testing.T) {
+	f, d := newFakeDrive(t)
+	f.add("root", "a", "txt", false, "content")
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := root.Get("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.hang = true
+	m := NewTransferManager(d, 1, 3)
+	m.Download(file, filepath.Join(t.TempDir(), "a.txt"))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	results, _ := m.Run(ctx, nil)
+	if err := results[0].Err; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hung request was canceled after %v", elapsed)
+	}
+}
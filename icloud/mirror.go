@@ -0,0 +1,282 @@
+package icloud
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// MirrorDirection tells which side is the source of a mirror
+type MirrorDirection int
+
+// Mirror directions
+const (
+	MirrorUp   MirrorDirection = iota // make remote tree match local one
+	MirrorDown                        // make local tree match remote one
+)
+
+// Mirror actions, applied on the destination side
+const (
+	MirrorMkdir  ActionOp = "mkdir"  // create missing folder
+	MirrorCopy   ActionOp = "copy"   // transfer missing file
+	MirrorUpdate ActionOp = "update" // replace different file
+	MirrorDelete ActionOp = "delete" // remove item missing on the source side
+)
+
+// MirrorOptions configures a mirror
+type MirrorOptions struct {
+	Direction MirrorDirection
+	Checksum  bool             // compare files by content signature instead of size and time
+	Delete    bool             // trash remote or remove local files missing on the source side
+	Backup    string           // directory receiving deleted local files instead of removing them
+	DryRun    bool             // report actions without touching either side
+	Transfer  []TransferOption // options of individual transfers
+}
+
+// mtimeTolerance is the largest difference of equal modification times
+const mtimeTolerance = time.Second
+
+// Mirror makes remote folder match local directory or vice versa.
+// Only the destination side is changed, files present on both sides
+// are compared by size and time or, with Checksum, by content.
+// A file failing to transfer is reported in *TreeError
+// and the rest of the tree is still mirrored.
+func Mirror(local string, remote *DriveNode, opts MirrorOptions) ([]Action, error) {
+	if !remote.IsDir() {
+		return nil, ErrNotDir
+	}
+	m := &mirror{
+		planner: newPlanner(opts.DryRun),
+		d:       remote.d,
+		opts:    opts,
+		o:       newTransferOptions(opts.Transfer),
+	}
+	m.backup = opts.Backup
+	if opts.Direction == MirrorUp {
+		m.up(local, remote, "")
+	} else {
+		if !opts.DryRun {
+			if err := os.MkdirAll(local, 0o755); err != nil {
+				return nil, err
+			}
+		}
+		m.down(local, remote, "")
+	}
+	return m.result()
+}
+
+// mirror keeps state of a running mirror
+type mirror struct {
+	*planner
+	d    *DriveService
+	opts MirrorOptions
+	o    *transferOptions
+}
+
+// mirrorEntries lists both sides of a folder by local name, remote can be nil.
+// Remote children are matched to local entries by normalized drive names.
+func mirrorEntries(d *DriveService, localDir string, remote *DriveNode) (map[string]os.FileInfo, map[string]*DriveNode, []string, error) {
+	locals := map[string]os.FileInfo{}
+	remotes := map[string]*DriveNode{}
+	names := []string{}
+	localNames := map[string]string{} // by name key
+	entries, err := os.ReadDir(localDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, nil, err
+	}
+	for _, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if fi.IsDir() || fi.Mode().IsRegular() {
+			locals[fi.Name()] = fi
+			names = append(names, fi.Name())
+			localNames[d.nameKey(d.RemoteName(fi.Name()))] = fi.Name()
+		}
+	}
+	if remote != nil {
+		children, err := remote.Children()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, child := range children {
+			name, ok := localNames[d.nameKey(child.Name())]
+			if !ok {
+				name = d.LocalName(child.Name())
+			}
+			if _, dup := remotes[name]; dup {
+				continue
+			}
+			remotes[name] = child
+			if locals[name] == nil {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return locals, remotes, names, nil
+}
+
+// same tells whether local file matches remote one
+func (m *mirror) same(localPath string, fi os.FileInfo, node *DriveNode) (bool, error) {
+	if fi.Size() != node.Size() {
+		return false, nil
+	}
+	if !m.opts.Checksum {
+		return sameTime(fi.ModTime(), node.Modified()), nil
+	}
+	if fi.Size() == 0 {
+		// drive has no signature of empty files
+		return true, nil
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+	localSig, err := Signature(f)
+	if err != nil {
+		return false, err
+	}
+	remoteSig, err := node.Signature()
+	if err != nil {
+		return false, err
+	}
+	return localSig == remoteSig, nil
+}
+
+// up mirrors local directory into remote folder, which is nil in dry-run if missing
+func (m *mirror) up(localDir string, folder *DriveNode, rel string) {
+	locals, remotes, names, err := mirrorEntries(m.d, localDir, folder)
+	if err != nil {
+		m.errs.add(localDir, err)
+		return
+	}
+	for _, name := range names {
+		fi, node := locals[name], remotes[name]
+		localPath := filepath.Join(localDir, name)
+		relPath := path.Join(rel, name)
+		isDir := (fi != nil && fi.IsDir()) || (fi == nil && node.IsDir())
+		if !m.o.included(relPath, isDir) {
+			continue
+		}
+		if node != nil && (fi == nil || fi.IsDir() != node.IsDir()) {
+			if fi != nil && !m.opts.Delete {
+				m.errs.add(localPath, ErrExists)
+				continue
+			}
+			if m.opts.Delete && m.plan(MirrorDelete, relPath) {
+				if err := node.Delete(); err != nil {
+					m.errs.add(relPath, err)
+					continue
+				}
+			}
+			node = nil
+		}
+		switch {
+		case fi == nil:
+			// extra remote item handled above
+		case fi.IsDir():
+			if node == nil && m.plan(MirrorMkdir, relPath) {
+				node, err = folder.Mkdir(m.d.RemoteName(name))
+				if err != nil {
+					m.errs.add(relPath, err)
+					continue
+				}
+			}
+			m.up(localPath, node, relPath)
+		case node == nil:
+			if m.plan(MirrorCopy, relPath) {
+				if _, err := folder.Upload(localPath, m.opts.Transfer...); err != nil {
+					m.errs.add(localPath, err)
+				}
+			}
+		default:
+			same, err := m.same(localPath, fi, node)
+			if err != nil {
+				m.errs.add(localPath, err)
+			} else if !same && m.plan(MirrorUpdate, relPath) {
+				if err := m.update(localPath, fi, node); err != nil {
+					m.errs.add(localPath, err)
+				}
+			}
+		}
+	}
+}
+
+// update replaces remote file content with local file
+func (m *mirror) update(localPath string, fi os.FileInfo, node *DriveNode) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	return node.Update(f, fi.Size(), fi.ModTime(), m.opts.Transfer...)
+}
+
+// down mirrors remote folder into local directory
+func (m *mirror) down(localDir string, folder *DriveNode, rel string) {
+	locals, remotes, names, err := mirrorEntries(m.d, localDir, folder)
+	if err != nil {
+		m.errs.add(localDir, err)
+		return
+	}
+	for _, name := range names {
+		fi, node := locals[name], remotes[name]
+		localPath := filepath.Join(localDir, name)
+		relPath := path.Join(rel, name)
+		isDir := (node != nil && node.IsDir()) || (node == nil && fi.IsDir())
+		if !m.o.included(relPath, isDir) {
+			continue
+		}
+		if fi != nil && (node == nil || fi.IsDir() != node.IsDir()) {
+			if node != nil && !m.opts.Delete {
+				m.errs.add(localPath, ErrExists)
+				continue
+			}
+			if m.opts.Delete && m.plan(MirrorDelete, relPath) {
+				if err := m.removeLocal(localPath, relPath); err != nil {
+					m.errs.add(localPath, err)
+					continue
+				}
+			}
+			fi = nil
+		}
+		switch {
+		case node == nil:
+			// extra local item handled above
+		case node.IsDir():
+			if fi == nil && m.plan(MirrorMkdir, relPath) {
+				if err := os.MkdirAll(localPath, 0o755); err != nil {
+					m.errs.add(localPath, err)
+					continue
+				}
+			}
+			m.down(localPath, node, relPath)
+		default:
+			op := MirrorCopy
+			if fi != nil {
+				same, err := m.same(localPath, fi, node)
+				if err != nil {
+					m.errs.add(localPath, err)
+					continue
+				}
+				if same {
+					continue
+				}
+				op = MirrorUpdate
+			}
+			if m.plan(op, relPath) {
+				err := node.Download(localPath, m.opts.Transfer...)
+				if mtime := node.Modified(); err == nil && !mtime.IsZero() {
+					err = os.Chtimes(localPath, mtime, mtime)
+				}
+				if err != nil {
+					m.errs.add(localPath, err)
+				}
+			}
+		}
+	}
+}
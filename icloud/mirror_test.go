@@ -0,0 +1,114 @@
+package icloud
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTree creates local files given by slash-separated paths
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMirrorUpPlan(t *testing.T) {
+	_, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"a/x.txt": "x", "b.txt": "b", "empty": ""})
+
+	want := []Action{
+		{Op: MirrorMkdir, Path: "a"},
+		{Op: MirrorCopy, Path: "a/x.txt"},
+		{Op: MirrorCopy, Path: "b.txt"},
+		{Op: MirrorCopy, Path: "empty"},
+	}
+	acts, err := Mirror(local, root, MirrorOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(acts, want) {
+		t.Fatalf("dry run planned %v, want %v", acts, want)
+	}
+	if names, _ := root.Dir(); len(names) != 0 {
+		t.Fatalf("dry run changed remote: %v", names)
+	}
+
+	if acts, err = Mirror(local, root, MirrorOptions{}); err != nil || !reflect.DeepEqual(acts, want) {
+		t.Fatalf("mirror performed %v, %v, want %v", acts, err, want)
+	}
+	for _, checksum := range []bool{false, true} {
+		acts, err = Mirror(local, root, MirrorOptions{Checksum: checksum})
+		if err != nil || len(acts) != 0 {
+			t.Errorf("checksum %v: repeated mirror performed %v, %v", checksum, acts, err)
+		}
+	}
+}
+
+func TestMirrorDownCreatesRoot(t *testing.T) {
+	f, d := newFakeDrive(t)
+	dir := f.add("root", "dir", "", true, "")
+	f.add(dir, "x", "txt", false, "x")
+	f.add("root", "a", "txt", false, "a")
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(t.TempDir(), "missing")
+	acts, err := Mirror(local, root, MirrorOptions{Direction: MirrorDown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Action{{Op: MirrorCopy, Path: "a.txt"}, {Op: MirrorMkdir, Path: "dir"}, {Op: MirrorCopy, Path: "dir/x.txt"}}
+	if !reflect.DeepEqual(acts, want) {
+		t.Fatalf("mirror performed %v, want %v", acts, want)
+	}
+	data, err := os.ReadFile(filepath.Join(local, "dir", "x.txt"))
+	if err != nil || string(data) != "x" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+}
+
+func TestMirrorDownDelete(t *testing.T) {
+	for _, withBackup := range []bool{false, true} {
+		f, d := newFakeDrive(t)
+		f.add("root", "keep", "txt", false, "k")
+		root, err := d.Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		local := t.TempDir()
+		writeTree(t, local, map[string]string{"keep.txt": "k", "extra/x.txt": "x"})
+		backup := ""
+		if withBackup {
+			backup = filepath.Join(t.TempDir(), "backup")
+		}
+		acts, err := Mirror(local, root, MirrorOptions{Direction: MirrorDown, Delete: true, Backup: backup, Checksum: true})
+		want := []Action{{Op: MirrorDelete, Path: "extra"}}
+		if err != nil || !reflect.DeepEqual(acts, want) {
+			t.Fatalf("backup %v: mirror performed %v, %v, want %v", withBackup, acts, err, want)
+		}
+		if _, err = os.Stat(filepath.Join(local, "extra")); !os.IsNotExist(err) {
+			t.Errorf("backup %v: extra folder not deleted: %v", withBackup, err)
+		}
+		if withBackup {
+			data, err := os.ReadFile(filepath.Join(backup, "extra", "x.txt"))
+			if err != nil || string(data) != "x" {
+				t.Errorf("backup has %q, %v", data, err)
+			}
+		}
+	}
+}
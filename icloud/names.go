@@ -0,0 +1,204 @@
+package icloud
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Encoding tells which characters of drive names are replaced
+// in local file names. Replaced characters become their lookalikes,
+// e.g. ":" becomes fullwidth "：". Lookalikes already present in a name
+// are quoted with "‛", and so are quotes preceding them, so that
+// Encode and Decode are inverse of each other for any name.
+type Encoding uint
+
+// Encoding flags
+const (
+	EncodeSlash         Encoding = 1 << iota // "/" is invalid in local names
+	EncodeColon                              // ":" is invalid on Windows
+	EncodeTrailingSpace                      // trailing space is invalid on Windows
+	EncodeTrailingDot                        // trailing dot is invalid on Windows
+
+	EncodeNone    Encoding = 0
+	EncodeWindows          = EncodeSlash | EncodeColon | EncodeTrailingSpace | EncodeTrailingDot
+)
+
+// EncodeDefault encodes characters invalid in local names on this platform
+var EncodeDefault = platformEncoding(runtime.GOOS)
+
+// platformEncoding returns default encoding of an operating system
+func platformEncoding(goos string) Encoding {
+	if goos == "windows" {
+		return EncodeWindows
+	}
+	return EncodeSlash
+}
+
+// encodeQuote marks a lookalike character present in original name
+const encodeQuote = '‛'
+
+// encodeRunes maps original characters to their lookalikes
+var encodeRunes = []struct {
+	flag      Encoding
+	orig      rune
+	lookalike rune
+	trailing  bool // replaced only at the end of name
+}{
+	{EncodeSlash, '/', '／', false},
+	{EncodeColon, ':', '：', false},
+	{EncodeTrailingSpace, ' ', '␠', true},
+	{EncodeTrailingDot, '.', '．', true},
+}
+
+// lookalike returns replacement of a character at given position or 0
+func (e Encoding) lookalike(r rune, last bool) rune {
+	for _, er := range encodeRunes {
+		if e&er.flag != 0 && er.orig == r && (last || !er.trailing) {
+			return er.lookalike
+		}
+	}
+	return 0
+}
+
+// original returns character replaced by a lookalike at given position or 0
+func (e Encoding) original(r rune, last bool) rune {
+	for _, er := range encodeRunes {
+		if e&er.flag != 0 && er.lookalike == r && (last || !er.trailing) {
+			return er.orig
+		}
+	}
+	return 0
+}
+
+// quoted tells whether a run of quotes starting at given position
+// precedes a character which is replaced or quoted
+func (e Encoding) quoted(runes []rune, i int) bool {
+	for i < len(runes) && runes[i] == encodeQuote {
+		i++
+	}
+	if i == len(runes) {
+		return false
+	}
+	last := i == len(runes)-1
+	return e.lookalike(runes[i], last) != 0 || e.original(runes[i], last) != 0
+}
+
+// Encode converts drive name into local file name
+func (e Encoding) Encode(name string) string {
+	if e == EncodeNone {
+		return name
+	}
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		last := i == len(runes)-1
+		switch {
+		case r == encodeQuote:
+			b.WriteRune(r)
+			if e.quoted(runes, i) {
+				b.WriteRune(r)
+			}
+		case e.lookalike(r, last) != 0:
+			b.WriteRune(e.lookalike(r, last))
+		case e.original(r, last) != 0:
+			b.WriteRune(encodeQuote)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Decode converts local file name into drive name
+func (e Encoding) Decode(name string) string {
+	if e == EncodeNone {
+		return name
+	}
+	runes := []rune(name)
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == encodeQuote {
+			// a run of quotes before lookalike is halved,
+			// odd quote keeps the lookalike itself
+			j := i
+			for j < len(runes) && runes[j] == encodeQuote {
+				j++
+			}
+			count := j - i
+			if j == len(runes) || e.original(runes[j], j == len(runes)-1) == 0 {
+				b.WriteString(strings.Repeat(string(encodeQuote), count))
+				i = j - 1
+				continue
+			}
+			b.WriteString(strings.Repeat(string(encodeQuote), count/2))
+			i, r = j, runes[j]
+			if count%2 == 1 {
+				b.WriteRune(r)
+				continue
+			}
+		}
+		if orig := e.original(r, i == len(runes)-1); orig != 0 {
+			r = orig
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// SetEncoding selects how drive names are converted into local names,
+// the default is EncodeDefault of the platform
+func (d *DriveService) SetEncoding(enc Encoding) {
+	d.enc = enc
+}
+
+// LocalName converts drive name into local file name
+func (d *DriveService) LocalName(name string) string {
+	return d.enc.Encode(name)
+}
+
+// RemoteName converts local file name into drive name
+func (d *DriveService) RemoteName(name string) string {
+	return d.enc.Decode(name)
+}
+
+// splitExt splits a name into base and extension the way drive does.
+// Dotfiles like ".bashrc" and names ending with a dot have no extension,
+// only the last suffix of multi-dot names like "a.tar.gz" is the extension.
+func splitExt(name string) (base, ext string) {
+	i := strings.LastIndexByte(name, '.')
+	if i <= 0 || i == len(name)-1 {
+		return name, ""
+	}
+	return name[:i], name[i+1:]
+}
+
+// joinExt returns full name given base and extension
+func joinExt(base, ext string) string {
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+// checkName rejects names which cannot be stored on drive
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, '/') {
+		return fmt.Errorf("%q: %w", name, ErrInvalidName)
+	}
+	return nil
+}
+
+// nameKey returns form of a name used for comparison.
+// Names are compared in NFC, because macOS uploads names in NFD.
+func (d *DriveService) nameKey(name string) string {
+	name = norm.NFC.String(name)
+	if d.foldCase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
@@ -0,0 +1,180 @@
+package icloud
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		enc   Encoding
+		drive string
+		local string
+	}{
+		{EncodeNone, "a/b:c.", "a/b:c."},
+		{EncodeSlash, "a/b", "a／b"},
+		{EncodeSlash, "a:b.", "a:b."},
+		{EncodeSlash, "会議：議事録.txt", "会議：議事録.txt"},
+		{EncodeSlash, "a／b", "a‛／b"},
+		{EncodeSlash, "‛/", "‛‛／"},
+		{EncodeSlash, "‛／", "‛‛‛／"},
+		{EncodeSlash, "‛x", "‛x"},
+		{EncodeSlash, "x‛", "x‛"},
+		{EncodeWindows, "a:b", "a：b"},
+		{EncodeWindows, "会議：議事録.txt", "会議‛：議事録.txt"},
+		{EncodeWindows, "x ", "x␠"},
+		{EncodeWindows, "x.", "x．"},
+		{EncodeWindows, "x．", "x‛．"},
+		{EncodeWindows, "Ｑ．Ａ．txt", "Ｑ．Ａ．txt"},
+		{EncodeWindows, "a. b", "a. b"},
+		{EncodeWindows, "a ..", "a .．"},
+		{EncodeWindows, "‛‛:", "‛‛‛‛："},
+	}
+	for _, tt := range tests {
+		if got := tt.enc.Encode(tt.drive); got != tt.local {
+			t.Errorf("%d.Encode(%q) = %q, want %q", tt.enc, tt.drive, got, tt.local)
+		}
+		if got := tt.enc.Decode(tt.local); got != tt.drive {
+			t.Errorf("%d.Decode(%q) = %q, want %q", tt.enc, tt.local, got, tt.drive)
+		}
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	// every combination of special characters up to 4 long
+	alphabet := []rune{'a', '.', ' ', '/', ':', '／', '：', '．', '␠', encodeQuote}
+	names := []string{""}
+	for length := 1; length <= 4; length++ {
+		for _, prefix := range names {
+			if len([]rune(prefix)) != length-1 {
+				continue
+			}
+			for _, r := range alphabet {
+				names = append(names, prefix+string(r))
+			}
+		}
+	}
+	for _, enc := range []Encoding{EncodeSlash, EncodeColon, EncodeTrailingDot, EncodeWindows} {
+		for _, name := range names {
+			local := enc.Encode(name)
+			if got := enc.Decode(local); got != name {
+				t.Errorf("%d: %q encoded as %q decodes to %q", enc, name, local, got)
+			}
+			if !validLocal(enc, name) {
+				continue
+			}
+			if got := enc.Encode(enc.Decode(name)); got != name {
+				t.Errorf("%d: local %q decoded as %q encodes to %q", enc, name, enc.Decode(name), got)
+			}
+			if enc&EncodeSlash != 0 && strings.ContainsRune(local, '/') {
+				t.Errorf("%d: %q encoded as %q", enc, name, local)
+			}
+		}
+	}
+}
+
+// validLocal tells whether a name has no characters replaced by encoding
+func validLocal(enc Encoding, name string) bool {
+	runes := []rune(name)
+	for i, r := range runes {
+		if enc.lookalike(r, i == len(runes)-1) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPlatformEncoding(t *testing.T) {
+	for goos, want := range map[string]Encoding{
+		"linux":   EncodeSlash,
+		"darwin":  EncodeSlash,
+		"windows": EncodeWindows,
+	} {
+		if got := platformEncoding(goos); got != want {
+			t.Errorf("platformEncoding(%q) = %d, want %d", goos, got, want)
+		}
+	}
+}
+
+func TestNameKey(t *testing.T) {
+	nfc, nfd := "Café.txt", "Café.txt"
+	d := &DriveService{}
+	if d.nameKey(nfc) != d.nameKey(nfd) {
+		t.Errorf("NFC and NFD forms of %q differ", nfc)
+	}
+	if d.nameKey("A.txt") == d.nameKey("a.txt") {
+		t.Error("names differing in case match")
+	}
+	d.SetCaseInsensitive(true)
+	if d.nameKey("A.txt") != d.nameKey("a.txt") {
+		t.Error("names differing in case do not match")
+	}
+}
+
+func TestPutStreamRejectsPath(t *testing.T) {
+	_, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = root.PutStream(strings.NewReader("x"), "dir/file.txt", 1, time.Now())
+	if !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidName)
+	}
+}
+
+func TestSplitExt(t *testing.T) {
+	tests := []struct {
+		name, base, ext string
+	}{
+		{"a.txt", "a", "txt"},
+		{"a.tar.gz", "a.tar", "gz"},
+		{"noext", "noext", ""},
+		{".hidden", ".hidden", ""},
+		{"trailing.", "trailing.", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		base, ext := splitExt(tt.name)
+		if base != tt.base || ext != tt.ext {
+			t.Errorf("splitExt(%q) = %q, %q, want %q, %q", tt.name, base, ext, tt.base, tt.ext)
+		}
+		if got := joinExt(base, ext); got != tt.name {
+			t.Errorf("joinExt(%q, %q) = %q, want %q", base, ext, got, tt.name)
+		}
+	}
+}
+
+func TestFreeName(t *testing.T) {
+	tests := []struct {
+		used []string
+		name string
+		want string
+	}{
+		{nil, "a.txt", "a.txt"},
+		{[]string{"a.txt"}, "a.txt", "a 2.txt"},
+		{[]string{"a.txt", "a 2.txt"}, "a.txt", "a 3.txt"},
+		{[]string{"dir"}, "dir", "dir 2"},
+		{[]string{"Café.txt"}, "Café.txt", "Café 2.txt"},
+		{[]string{"A.txt"}, "a.txt", "a.txt"},
+	}
+	d := &DriveService{}
+	for _, tt := range tests {
+		used := map[string]bool{}
+		for _, name := range tt.used {
+			used[d.nameKey(name)] = true
+		}
+		if got := d.freeName(tt.name, used); got != tt.want {
+			t.Errorf("freeName(%q) with %v = %q, want %q", tt.name, tt.used, got, tt.want)
+		}
+		if !used[d.nameKey(tt.want)] {
+			t.Errorf("freeName(%q) did not mark %q used", tt.name, tt.want)
+		}
+	}
+	d.SetCaseInsensitive(true)
+	if got := d.freeName("a.txt", map[string]bool{d.nameKey("A.TXT"): true}); got != "a 2.txt" {
+		t.Errorf("case insensitive freeName = %q, want %q", got, "a 2.txt")
+	}
+}
@@ -0,0 +1,115 @@
+package icloud
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Conflict tells what to do when uploaded file name already exists
+type Conflict int
+
+// Conflict resolution policies
+const (
+	ConflictKeepBoth  Conflict = iota // create a conflicting copy (iCloud default)
+	ConflictFail                      // return ErrExists
+	ConflictOverwrite                 // replace content of existing file
+	ConflictRename                    // upload under a unique name
+	ConflictSkip                      // keep existing file and skip upload
+	ConflictUpdate                    // replace existing file unless it has same size and time
+)
+
+// TransferOption configures a single upload or download
+type TransferOption func(*transferOptions)
+
+// transferOptions keeps settings of a transfer
+type transferOptions struct {
+	conflict Conflict
+	progress func(Progress)
+	limit    *rateLimiter
+	ctx      context.Context
+	include  []string
+	exclude  []string
+	strict   bool
+}
+
+// newTransferOptions applies options over defaults
+func newTransferOptions(opts []TransferOption) *transferOptions {
+	o := &transferOptions{
+		conflict: ConflictKeepBoth,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// OnConflict sets conflict resolution policy for uploads
+func OnConflict(conflict Conflict) TransferOption {
+	return func(o *transferOptions) { o.conflict = conflict }
+}
+
+// WithProgress sets a callback receiving transfer progress.
+// The callback is called from the transferring goroutine.
+func WithProgress(fn func(Progress)) TransferOption {
+	return func(o *transferOptions) { o.progress = fn }
+}
+
+// WithRateLimit limits transfer rate in bytes per second.
+// It applies on top of global service limits.
+func WithRateLimit(rate int64) TransferOption {
+	return func(o *transferOptions) { o.limit = newRateLimiter(rate) }
+}
+
+// WithContext makes transfer stop when context is canceled,
+// including requests in progress
+func WithContext(ctx context.Context) TransferOption {
+	return func(o *transferOptions) { o.ctx = ctx }
+}
+
+// StrictChecksum makes transfers fail with ErrUnverifiable if server
+// signature cannot be checked, by default such transfers log a warning
+func StrictChecksum() TransferOption {
+	return func(o *transferOptions) { o.strict = true }
+}
+
+// checked applies checksum policy to a signature verification result
+func (o *transferOptions) checked(err error) error {
+	if errors.Is(err, ErrUnverifiable) && !o.strict {
+		log.Warnf("%v, integrity not checked", err)
+		return nil
+	}
+	return err
+}
+
+// requestContext returns context of transfer requests
+func (o *transferOptions) requestContext() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// ctxReader stops reading when context is canceled
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// contextReader returns reader bound to transfer context, if any
+func (o *transferOptions) contextReader(r io.Reader) io.Reader {
+	if o.ctx == nil {
+		return r
+	}
+	return &ctxReader{ctx: o.ctx, r: r}
+}
+
+// Read implements io.Reader
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
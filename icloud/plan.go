@@ -0,0 +1,119 @@
+package icloud
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ActionOp is an operation of Mirror, Syncer or Dedupe
+type ActionOp string
+
+// Action is an operation on one path of a tree.
+// Mirror, Syncer and Dedupe report actions they performed
+// or, in dry run, the ones they would perform.
+type Action struct {
+	Op      ActionOp
+	Path    string // slash-separated path relative to the root
+	ID      string // drivews id, set by Dedupe to tell same-name nodes apart
+	NewName string // new name of a node renamed by Dedupe
+}
+
+// planner records actions of a tree operation and errors of its paths
+type planner struct {
+	dryRun  bool
+	backup  string // directory receiving removed local files, empty to delete them
+	actions []Action
+	errs    *TreeError
+}
+
+// newPlanner returns planner of a new run
+func newPlanner(dryRun bool) *planner {
+	return &planner{dryRun: dryRun, errs: &TreeError{}}
+}
+
+// plan records an action on a path and tells whether to perform it
+func (p *planner) plan(op ActionOp, rel string) bool {
+	return p.add(Action{Op: op, Path: rel})
+}
+
+// add records an action and tells whether to perform it
+func (p *planner) add(a Action) bool {
+	p.actions = append(p.actions, a)
+	return !p.dryRun
+}
+
+// result returns recorded actions and errors
+func (p *planner) result() ([]Action, error) {
+	return p.actions, p.errs.result()
+}
+
+// removeLocal deletes a local file or directory tree. With backup directory
+// it's moved there under its relative path instead, getting a numbered
+// name if an older backup exists.
+func (p *planner) removeLocal(localPath, rel string) error {
+	if p.backup == "" {
+		return os.RemoveAll(localPath)
+	}
+	dest := filepath.Join(p.backup, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+		return err
+	}
+	base := dest
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(dest); os.IsNotExist(err) {
+			break
+		}
+		dest = fmt.Sprintf("%s %d", base, i)
+	}
+	if os.Rename(localPath, dest) == nil {
+		return nil
+	}
+	// backup may be on another file system
+	if err := copyLocal(localPath, dest); err != nil {
+		_ = os.RemoveAll(dest)
+		return err
+	}
+	return os.RemoveAll(localPath)
+}
+
+// copyLocal copies a local file or directory tree keeping modification times
+func copyLocal(src, dest string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if err = os.Mkdir(dest, 0o700); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err = copyLocal(filepath.Join(src, entry.Name()), filepath.Join(dest, entry.Name())); err != nil {
+				return err
+			}
+		}
+	} else {
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = in.Close() }()
+		out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, in)
+		if errClose := out.Close(); err == nil {
+			err = errClose
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return os.Chtimes(dest, fi.ModTime(), fi.ModTime())
+}
@@ -0,0 +1,66 @@
+package icloud
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlanner(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		p := newPlanner(dryRun)
+		if got := p.plan(MirrorCopy, "a"); got == dryRun {
+			t.Errorf("dry run %v: plan returned %v", dryRun, got)
+		}
+		p.errs.add("b", ErrExists)
+		acts, err := p.result()
+		if !reflect.DeepEqual(acts, []Action{{Op: MirrorCopy, Path: "a"}}) || err == nil {
+			t.Errorf("dry run %v: got %v, %v", dryRun, acts, err)
+		}
+	}
+	if _, err := newPlanner(false).result(); err != nil {
+		t.Errorf("no errors reported as %v", err)
+	}
+}
+
+func TestRemoveLocal(t *testing.T) {
+	local, backup := t.TempDir(), filepath.Join(t.TempDir(), "backup")
+	p := newPlanner(false)
+	p.backup = backup
+	for _, content := range []string{"old", "new"} {
+		writeTree(t, local, map[string]string{"dir/x.txt": content})
+		if err := p.removeLocal(filepath.Join(local, "dir", "x.txt"), "dir/x.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{"x.txt": "old", "x.txt 2": "new"} {
+		data, err := os.ReadFile(filepath.Join(backup, "dir", name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v, want %q", name, data, err, want)
+		}
+	}
+
+	p.backup = ""
+	if err := p.removeLocal(filepath.Join(local, "dir"), "dir"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(local, "dir")); !os.IsNotExist(err) {
+		t.Errorf("folder not removed: %v", err)
+	}
+}
+
+func TestCopyLocal(t *testing.T) {
+	src, dest := t.TempDir(), filepath.Join(t.TempDir(), "copy")
+	files := map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/deep/c.txt": "c"}
+	writeTree(t, src, files)
+	if err := copyLocal(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range files {
+		data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v", name, data, err)
+		}
+	}
+}
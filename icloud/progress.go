@@ -0,0 +1,105 @@
+package icloud
+
+import (
+	"fmt"
+	"time"
+)
+
+// Phase of a transfer
+type Phase int
+
+// Transfer phases
+const (
+	PhaseRequest  Phase = iota // requesting upload or download url
+	PhaseUpload                // sending content
+	PhaseCommit                // committing uploaded file metadata
+	PhaseDownload              // receiving content
+	PhaseDone                  // transfer finished
+)
+
+// String returns phase name
+func (p Phase) String() string {
+	switch p {
+	case PhaseRequest:
+		return "request"
+	case PhaseUpload:
+		return "upload"
+	case PhaseCommit:
+		return "commit"
+	case PhaseDownload:
+		return "download"
+	case PhaseDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// Progress describes state of a transfer
+type Progress struct {
+	Name  string  // file name
+	Phase Phase   // current phase
+	Bytes int64   // bytes transferred so far
+	Total int64   // total file size
+	Rate  float64 // average rate in bytes per second
+}
+
+// progressInterval limits how often progress is reported
+const progressInterval = 200 * time.Millisecond
+
+// progressMeter counts transferred bytes and reports progress
+type progressMeter struct {
+	fn    func(Progress)
+	p     Progress
+	start time.Time
+	last  time.Time
+}
+
+// newProgressMeter returns a meter reporting to fn, which can be nil
+func newProgressMeter(fn func(Progress), name string, total int64) *progressMeter {
+	return &progressMeter{
+		fn:    fn,
+		p:     Progress{Name: name, Total: total},
+		start: time.Now(),
+	}
+}
+
+// phase reports start of next transfer phase
+func (m *progressMeter) phase(phase Phase) {
+	m.p.Phase = phase
+	m.report()
+}
+
+// Write counts transferred bytes
+func (m *progressMeter) Write(b []byte) (int, error) {
+	m.p.Bytes += int64(len(b))
+	if time.Since(m.last) >= progressInterval || m.p.Bytes == m.p.Total {
+		m.report()
+	}
+	return len(b), nil
+}
+
+// report calls progress callback
+func (m *progressMeter) report() {
+	if m.fn == nil {
+		return
+	}
+	m.last = time.Now()
+	if elapsed := m.last.Sub(m.start).Seconds(); elapsed > 0 {
+		m.p.Rate = float64(m.p.Bytes) / elapsed
+	}
+	m.fn(m.p)
+}
+
+// FormatSize returns human readable size
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,86 @@
+package icloud
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 40, "3.0 TiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatSize(tt.size); got != tt.want {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+// progressLog records progress callbacks of a transfer
+type progressLog struct {
+	phases []Phase
+	bytes  []int64
+}
+
+func (l *progressLog) record(p Progress) {
+	if n := len(l.phases); n == 0 || l.phases[n-1] != p.Phase {
+		l.phases = append(l.phases, p.Phase)
+	}
+	l.bytes = append(l.bytes, p.Bytes)
+}
+
+// check verifies phases and that byte counts grow up to the size
+func (l *progressLog) check(t *testing.T, want []Phase, size int64) {
+	t.Helper()
+	if !reflect.DeepEqual(l.phases, want) {
+		t.Errorf("got phases %v, want %v", l.phases, want)
+	}
+	for i := 1; i < len(l.bytes); i++ {
+		if l.bytes[i] < l.bytes[i-1] {
+			t.Errorf("byte count went back: %v", l.bytes)
+			break
+		}
+	}
+	if n := len(l.bytes); n == 0 || l.bytes[n-1] != size {
+		t.Errorf("got byte counts %v, want last %d", l.bytes, size)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	_, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	content := strings.Repeat("x", 3*limitChunk+1)
+	size := int64(len(content))
+	path := filepath.Join(dir, "a.txt")
+	if err = os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	up := &progressLog{}
+	node, err := root.Upload(path, WithProgress(up.record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	up.check(t, []Phase{PhaseRequest, PhaseUpload, PhaseCommit, PhaseDone}, size)
+
+	down := &progressLog{}
+	if err = node.Download(filepath.Join(dir, "b.txt"), WithProgress(down.record)); err != nil {
+		t.Fatal(err)
+	}
+	down.check(t, []Phase{PhaseRequest, PhaseDownload, PhaseDone}, size)
+}
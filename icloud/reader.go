@@ -0,0 +1,198 @@
+package icloud
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// urlExpiryMargin is how long before expiry a download url is refreshed
+const urlExpiryMargin = time.Minute
+
+// DriveReader provides random access to a drive file using range requests.
+// It implements io.ReadSeekCloser and io.ReaderAt, all methods are safe
+// for concurrent use.
+type DriveReader struct {
+	n    *DriveNode
+	ctx  context.Context
+	size int64
+
+	mu      sync.Mutex // guards download url
+	url     string
+	expires time.Time
+
+	pos     sync.Mutex // guards position and response of Read
+	offset  int64
+	body    io.ReadCloser
+	bodyPos int64
+}
+
+// NewReader returns random access reader of a file
+func (n *DriveNode) NewReader() (*DriveReader, error) {
+	if n.IsDir() {
+		return nil, ErrNotFile
+	}
+	return &DriveReader{n: n, ctx: context.Background(), size: n.Size()}, nil
+}
+
+// OpenAt opens file for reading starting at given offset
+func (n *DriveNode) OpenAt(offset int64) (io.ReadCloser, error) {
+	return n.openAt(context.Background(), offset)
+}
+
+// openAt opens file at given offset, requests are canceled with context
+func (n *DriveNode) openAt(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	if offset == 0 {
+		return n.open(ctx)
+	}
+	r, err := n.NewReader()
+	if err == nil {
+		r.ctx = ctx
+		_, err = r.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Size returns file size
+func (r *DriveReader) Size() int64 { return r.size }
+
+// Read implements io.Reader
+func (r *DriveReader) Read(p []byte) (int, error) {
+	r.pos.Lock()
+	defer r.pos.Unlock()
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body != nil && r.bodyPos != r.offset {
+		_ = r.body.Close()
+		r.body = nil
+	}
+	if r.body == nil {
+		body, err := r.openRange(r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body, r.bodyPos = body, r.offset
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	r.bodyPos += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (r *DriveReader) Seek(offset int64, whence int) (int64, error) {
+	r.pos.Lock()
+	defer r.pos.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt, it does not change position of Read
+func (r *DriveReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	if end == off {
+		return 0, nil
+	}
+	body, err := r.openRange(off, end-1)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = body.Close() }()
+	n, err := io.ReadFull(body, p[:end-off])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (r *DriveReader) Close() error {
+	r.pos.Lock()
+	defer r.pos.Unlock()
+	var err error
+	if r.body != nil {
+		err = r.body.Close()
+		r.body = nil
+	}
+	return err
+}
+
+// openRange requests a range of file, refreshing expired download url.
+// Url rejected by server is refreshed too in case it expired earlier.
+func (r *DriveReader) openRange(start, end int64) (io.ReadCloser, error) {
+	fileURL, fresh, err := r.downloadURL(false)
+	if err != nil {
+		return nil, err
+	}
+	body, err := r.n.d.getFileRange(r.ctx, fileURL, start, end)
+	var apiErr ErrAPI
+	if err != nil && !fresh && errors.As(err, &apiErr) &&
+		(apiErr.Code == http.StatusForbidden || apiErr.Code == http.StatusGone) {
+		if fileURL, _, err = r.downloadURL(true); err == nil {
+			body, err = r.n.d.getFileRange(r.ctx, fileURL, start, end)
+		}
+	}
+	return body, err
+}
+
+// downloadURL returns cached download url, fetching new one when expired
+func (r *DriveReader) downloadURL(refresh bool) (fileURL string, fresh bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expired := !r.expires.IsZero() && time.Until(r.expires) < urlExpiryMargin
+	if r.url == "" || refresh || expired {
+		if r.url, err = r.n.downloadURL(r.ctx); err != nil {
+			return "", false, err
+		}
+		r.expires = urlExpiry(r.url)
+		fresh = true
+	}
+	return r.url, fresh, nil
+}
+
+// urlExpiry returns expiry of signed download url, which is given
+// as unix time in its "e" parameter. It's zero if url has none.
+func urlExpiry(fileURL string) time.Time {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return time.Time{}
+	}
+	sec, err := strconv.ParseInt(u.Query().Get("e"), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
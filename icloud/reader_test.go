@@ -0,0 +1,116 @@
+package icloud
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countCalls returns number of recorded requests with given path prefix
+func (f *fakeDrive) countCalls(prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, p := range f.calls {
+		if strings.HasPrefix(p, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestURLExpiry(t *testing.T) {
+	tests := []struct {
+		url  string
+		want time.Time
+	}{
+		{"https://cvws.icloud-content.com/B/x?o=a&e=1600000000&k=b", time.Unix(1600000000, 0)},
+		{"https://cvws.icloud-content.com/B/x?o=a", time.Time{}},
+		{"https://cvws.icloud-content.com/B/x?e=soon", time.Time{}},
+		{"%zz", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := urlExpiry(tt.url); !got.Equal(tt.want) {
+			t.Errorf("urlExpiry(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestReaderRefreshesURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		gone   int
+		tokens int
+	}{
+		{"no expiry", 0, 0, 1},
+		{"valid", time.Hour, 0, 1},
+		{"expiring", time.Second, 0, 2},
+		{"rejected", time.Hour, 1, 2},
+	}
+	for _, tt := range tests {
+		f, d := newFakeDrive(t)
+		f.add("root", "a", "txt", false, "0123456789")
+		f.urlTTL = tt.ttl
+		root, _ := d.Root()
+		node, err := root.Get("a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := node.NewReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 4)
+		if _, err = r.ReadAt(buf, 0); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		f.mu.Lock()
+		f.gone = tt.gone
+		f.mu.Unlock()
+		if _, err = r.ReadAt(buf, 6); err != nil || string(buf) != "6789" {
+			t.Fatalf("%s: read %q, %v", tt.name, buf, err)
+		}
+		if n := f.countCalls("/ws/com.apple.CloudDocs/download/"); n != tt.tokens {
+			t.Errorf("%s: requested %d download urls, want %d", tt.name, n, tt.tokens)
+		}
+	}
+}
+
+func TestReaderConcurrentRead(t *testing.T) {
+	f, d := newFakeDrive(t)
+	content := strings.Repeat("0123456789", 100)
+	f.add("root", "a", "txt", false, content)
+	root, _ := d.Root()
+	node, err := root.Get("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := node.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+	// run with -race, readers share position so only total is checked
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, _ := io.Copy(io.Discard, r)
+			mu.Lock()
+			total += int(n)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if total != len(content) {
+		t.Errorf("read %d bytes, want %d", total, len(content))
+	}
+}
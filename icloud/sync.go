@@ -0,0 +1,383 @@
+package icloud
+
+import (
+	"crypto/sha1" //nolint:gosec // not used for security
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SyncPolicy resolves files changed on both sides
+type SyncPolicy int
+
+// Sync conflict policies
+const (
+	SyncNewerWins  SyncPolicy = iota // keep the file modified last
+	SyncLocalWins                    // keep local file
+	SyncRemoteWins                   // keep remote file
+	SyncKeepBoth                     // keep remote file, upload local one under a unique name
+)
+
+// Sync actions. A conflict is reported before the transfers resolving it.
+const (
+	SyncUpload       ActionOp = "upload"
+	SyncDownload     ActionOp = "download"
+	SyncMkdirLocal   ActionOp = "mkdir-local"
+	SyncMkdirRemote  ActionOp = "mkdir-remote"
+	SyncDeleteLocal  ActionOp = "delete-local"
+	SyncDeleteRemote ActionOp = "delete-remote"
+	SyncConflict     ActionOp = "conflict"
+)
+
+// syncEntry keeps state of a path after the last sync
+type syncEntry struct {
+	Dir   bool      `json:"dir,omitempty"`
+	Size  int64     `json:"size"`
+	Mtime time.Time `json:"mtime"`
+	Etag  string    `json:"etag"`
+}
+
+// Syncer keeps local directory and drive folder in two-way sync.
+// State of the last sync tells edits from deletions on each side.
+// Deleted remote files go to iCloud trash, deleted local ones are
+// moved into Backup directory.
+type Syncer struct {
+	Policy   SyncPolicy       // conflict resolution policy
+	Backup   string           // directory receiving deleted local files, empty removes them for good
+	DryRun   bool             // report actions, keeping both sides and the state intact
+	Transfer []TransferOption // options of individual transfers
+
+	*planner
+	local     string
+	remote    *DriveNode
+	statePath string
+	state     map[string]*syncEntry
+	newState  map[string]*syncEntry
+	o         *transferOptions
+}
+
+// NewSyncer returns syncer of local directory and remote folder.
+// Empty state path selects a file in the client data directory.
+// Backup directory is set next to the state file.
+func NewSyncer(local string, remote *DriveNode, statePath string) (*Syncer, error) {
+	if !remote.IsDir() {
+		return nil, ErrNotDir
+	}
+	if statePath == "" {
+		absLocal, err := filepath.Abs(local)
+		if err != nil {
+			return nil, err
+		}
+		key := sha1.Sum([]byte(absLocal + "\n" + remote.ID())) //nolint:gosec // not used for security
+		statePath = remote.d.c.dataPath(fmt.Sprintf("sync-%x.json", key[:8]))
+		if statePath == "" {
+			return nil, errors.New("sync state path is required")
+		}
+	}
+	s := &Syncer{
+		Backup:    strings.TrimSuffix(statePath, filepath.Ext(statePath)) + ".trash",
+		local:     local,
+		remote:    remote,
+		statePath: statePath,
+		state:     map[string]*syncEntry{},
+	}
+	data, err := os.ReadFile(statePath)
+	if err == nil {
+		err = json.Unmarshal(data, &s.state)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot load sync state from %s: %w", statePath, err)
+	}
+	return s, nil
+}
+
+// Run synchronizes both sides and saves the new state.
+// Paths failing to sync are reported in *TreeError and keep their
+// previous state, so the next run treats them as before.
+func (s *Syncer) Run() ([]Action, error) {
+	s.o = newTransferOptions(s.Transfer)
+	s.newState = map[string]*syncEntry{}
+	s.planner = newPlanner(s.DryRun)
+	s.backup = s.Backup
+
+	if !s.DryRun {
+		if err := os.MkdirAll(s.local, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	s.sync(s.local, s.remote, "")
+
+	if !s.DryRun {
+		if err := os.WriteFile(s.statePath, Marshal(s.newState), 0600); err != nil {
+			s.errs.add(s.statePath, err)
+		}
+		s.state = s.newState
+	}
+	return s.result()
+}
+
+// fail records error and keeps previous state of a path and its subtree
+func (s *Syncer) fail(rel string, err error) {
+	s.errs.add(rel, err)
+	for p, entry := range s.state {
+		if p == rel || strings.HasPrefix(p, rel+"/") {
+			s.newState[p] = entry
+		}
+	}
+}
+
+// sync processes a folder, remote folder is nil in dry-run if missing
+func (s *Syncer) sync(localDir string, folder *DriveNode, rel string) {
+	locals, remotes, names, err := mirrorEntries(s.remote.d, localDir, folder)
+	if err != nil {
+		s.fail(rel, err)
+		return
+	}
+	for _, name := range names {
+		fi, node := locals[name], remotes[name]
+		localPath := filepath.Join(localDir, name)
+		relPath := path.Join(rel, name)
+		isDir := (fi != nil && fi.IsDir()) || (fi == nil && node.IsDir())
+		if !s.o.included(relPath, isDir) {
+			continue
+		}
+		if fi != nil && node != nil && fi.IsDir() != node.IsDir() {
+			s.fail(relPath, fmt.Errorf("%w: file on one side, folder on another", ErrExists))
+			continue
+		}
+		if isDir {
+			s.syncDir(localPath, folder, node, fi != nil, relPath)
+		} else {
+			s.syncFile(localPath, folder, node, fi, relPath)
+		}
+	}
+}
+
+// syncDir processes a subfolder existing at least on one side
+func (s *Syncer) syncDir(localPath string, folder, node *DriveNode, hasLocal bool, rel string) {
+	prev := s.state[rel]
+	switch {
+	case hasLocal && node == nil:
+		if prev != nil && s.localUnchanged(localPath, rel) {
+			// deleted remotely and not changed locally
+			if s.plan(SyncDeleteLocal, rel) {
+				if err := s.removeLocal(localPath, rel); err != nil {
+					s.fail(rel, err)
+				}
+			}
+			return
+		}
+		if s.plan(SyncMkdirRemote, rel) {
+			name := path.Base(rel)
+			var err error
+			if node, err = folder.Mkdir(s.remote.d.RemoteName(name)); err != nil {
+				s.fail(rel, err)
+				return
+			}
+		}
+	case !hasLocal:
+		if prev != nil && s.remoteUnchanged(node, rel) {
+			// deleted locally and not changed remotely
+			if s.plan(SyncDeleteRemote, rel) {
+				if err := node.Delete(); err != nil {
+					s.fail(rel, err)
+				}
+			}
+			return
+		}
+		if s.plan(SyncMkdirLocal, rel) {
+			if err := os.MkdirAll(localPath, 0o755); err != nil {
+				s.fail(rel, err)
+				return
+			}
+		}
+	}
+	s.sync(localPath, node, rel)
+	entry := &syncEntry{Dir: true}
+	if node != nil {
+		entry.Etag = node.Etag()
+	}
+	s.newState[rel] = entry
+}
+
+// syncFile processes a file existing at least on one side
+func (s *Syncer) syncFile(localPath string, folder, node *DriveNode, fi os.FileInfo, rel string) {
+	prev := s.state[rel]
+	if prev != nil && prev.Dir {
+		prev = nil
+	}
+	localChanged := fi != nil && (prev == nil || fi.Size() != prev.Size || !sameTime(fi.ModTime(), prev.Mtime))
+	remoteChanged := node != nil && (prev == nil || node.Etag() != prev.Etag)
+
+	switch {
+	case fi != nil && node != nil:
+		switch {
+		case prev == nil && fi.Size() == node.Size() && sameTime(fi.ModTime(), node.Modified()):
+			s.record(rel, fi, node) // already equal
+		case prev == nil || (localChanged && remoteChanged):
+			s.conflict(localPath, folder, node, fi, rel)
+		case localChanged:
+			s.upload(localPath, folder, node, fi, rel)
+		case remoteChanged:
+			s.download(localPath, node, rel)
+		default:
+			s.newState[rel] = prev
+		}
+	case fi != nil:
+		if prev != nil && !localChanged {
+			// deleted remotely and not changed locally
+			if s.plan(SyncDeleteLocal, rel) {
+				if err := s.removeLocal(localPath, rel); err != nil {
+					s.fail(rel, err)
+				}
+			}
+		} else {
+			s.upload(localPath, folder, nil, fi, rel)
+		}
+	case node != nil:
+		if prev != nil && !remoteChanged {
+			// deleted locally and not changed remotely
+			if s.plan(SyncDeleteRemote, rel) {
+				if err := node.Delete(); err != nil {
+					s.fail(rel, err)
+				}
+			}
+		} else {
+			s.download(localPath, node, rel)
+		}
+	}
+}
+
+// conflict resolves a file changed on both sides
+func (s *Syncer) conflict(localPath string, folder, node *DriveNode, fi os.FileInfo, rel string) {
+	s.plan(SyncConflict, rel)
+	switch s.Policy {
+	case SyncLocalWins:
+		s.upload(localPath, folder, node, fi, rel)
+	case SyncRemoteWins:
+		s.download(localPath, node, rel)
+	case SyncKeepBoth:
+		if s.plan(SyncUpload, rel) {
+			opts := append(append([]TransferOption{}, s.Transfer...), OnConflict(ConflictRename))
+			if _, err := folder.Upload(localPath, opts...); err != nil {
+				s.fail(rel, err)
+				return
+			}
+		}
+		s.download(localPath, node, rel)
+	default:
+		if fi.ModTime().After(node.Modified()) {
+			s.upload(localPath, folder, node, fi, rel)
+		} else {
+			s.download(localPath, node, rel)
+		}
+	}
+}
+
+// upload sends local file replacing remote node, if any
+func (s *Syncer) upload(localPath string, folder, node *DriveNode, fi os.FileInfo, rel string) {
+	if !s.plan(SyncUpload, rel) {
+		return
+	}
+	var err error
+	if node != nil {
+		var f *os.File
+		if f, err = os.Open(localPath); err == nil {
+			err = node.Update(f, fi.Size(), fi.ModTime(), s.Transfer...)
+		}
+	} else {
+		node, err = folder.Upload(localPath, s.Transfer...)
+	}
+	if err != nil {
+		s.fail(rel, err)
+		return
+	}
+	s.record(rel, fi, node)
+}
+
+// download fetches remote file into local path
+func (s *Syncer) download(localPath string, node *DriveNode, rel string) {
+	if !s.plan(SyncDownload, rel) {
+		return
+	}
+	err := node.Download(localPath, s.Transfer...)
+	if mtime := node.Modified(); err == nil && !mtime.IsZero() {
+		err = os.Chtimes(localPath, mtime, mtime)
+	}
+	var fi os.FileInfo
+	if err == nil {
+		fi, err = os.Stat(localPath)
+	}
+	if err != nil {
+		s.fail(rel, err)
+		return
+	}
+	s.record(rel, fi, node)
+}
+
+// record saves synchronized state of a file
+func (s *Syncer) record(rel string, fi os.FileInfo, node *DriveNode) {
+	s.newState[rel] = &syncEntry{
+		Size:  fi.Size(),
+		Mtime: fi.ModTime(),
+		Etag:  node.Etag(),
+	}
+}
+
+// localUnchanged tells whether local tree matches the last sync state
+func (s *Syncer) localUnchanged(localDir, rel string) bool {
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		relPath := path.Join(rel, entry.Name())
+		prev := s.state[relPath]
+		fi, err := entry.Info()
+		if err != nil || prev == nil || prev.Dir != fi.IsDir() {
+			return false
+		}
+		if fi.IsDir() {
+			if !s.localUnchanged(filepath.Join(localDir, entry.Name()), relPath) {
+				return false
+			}
+		} else if fi.Size() != prev.Size || !sameTime(fi.ModTime(), prev.Mtime) {
+			return false
+		}
+	}
+	return true
+}
+
+// remoteUnchanged tells whether remote tree matches the last sync state
+func (s *Syncer) remoteUnchanged(folder *DriveNode, rel string) bool {
+	children, err := folder.Children()
+	if err != nil {
+		return false
+	}
+	for _, child := range children {
+		relPath := path.Join(rel, child.Name())
+		prev := s.state[relPath]
+		if prev == nil || prev.Dir != child.IsDir() {
+			return false
+		}
+		if child.IsDir() {
+			if !s.remoteUnchanged(child, relPath) {
+				return false
+			}
+		} else if child.Etag() != prev.Etag {
+			return false
+		}
+	}
+	return true
+}
+
+// sameTime compares modification times with tolerance
+func sameTime(a, b time.Time) bool {
+	diff := a.Sub(b)
+	return diff > -mtimeTolerance && diff < mtimeTolerance
+}
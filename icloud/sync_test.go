@@ -0,0 +1,311 @@
+package icloud
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syncFixture is a local directory and fake drive root kept in sync
+type syncFixture struct {
+	t     *testing.T
+	f     *fakeDrive
+	root  *DriveNode
+	local string
+	state string
+}
+
+// syncTime is modification time of files created by sync tests
+var syncTime = time.Unix(1600000000, 0)
+
+func newSyncFixture(t *testing.T) *syncFixture {
+	f, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &syncFixture{t: t, f: f, root: root, local: t.TempDir(), state: filepath.Join(t.TempDir(), "state.json")}
+}
+
+// run syncs both sides with a fresh syncer loading saved state
+func (x *syncFixture) run(policy SyncPolicy, dryRun bool) []Action {
+	x.t.Helper()
+	s, err := NewSyncer(x.local, x.root, x.state)
+	if err != nil {
+		x.t.Fatal(err)
+	}
+	s.Policy, s.DryRun = policy, dryRun
+	acts, err := s.Run()
+	if err != nil {
+		x.t.Fatal(err)
+	}
+	return acts
+}
+
+// putLocal writes local file with given modification time
+func (x *syncFixture) putLocal(name, content string, mtime time.Time) {
+	x.t.Helper()
+	writeTree(x.t, x.local, map[string]string{name: content})
+	if err := os.Chtimes(filepath.Join(x.local, name), mtime, mtime); err != nil {
+		x.t.Fatal(err)
+	}
+}
+
+// putRemote uploads or replaces a file in the drive root
+func (x *syncFixture) putRemote(name, content string, mtime time.Time) {
+	x.t.Helper()
+	_, err := x.root.PutStream(strings.NewReader(content), name, int64(len(content)), mtime, OnConflict(ConflictOverwrite))
+	if err != nil {
+		x.t.Fatal(err)
+	}
+}
+
+// localData returns content of local file, "-" if it's missing
+func (x *syncFixture) localData(name string) string {
+	data, err := os.ReadFile(filepath.Join(x.local, name))
+	if os.IsNotExist(err) {
+		return "-"
+	}
+	if err != nil {
+		x.t.Fatal(err)
+	}
+	return string(data)
+}
+
+// remoteData returns content of remote file, "-" if it's missing
+func (x *syncFixture) remoteData(name string) string {
+	node, err := x.root.Get(name)
+	if err != nil {
+		return "-"
+	}
+	r, err := node.Open()
+	if err != nil {
+		x.t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		x.t.Fatal(err)
+	}
+	return string(data)
+}
+
+// check compares actions and contents of both sides
+func (x *syncFixture) check(what string, acts, wantActs []Action, files map[string][2]string) {
+	x.t.Helper()
+	if len(acts) != 0 || len(wantActs) != 0 {
+		if !reflect.DeepEqual(acts, wantActs) {
+			x.t.Errorf("%s: performed %v, want %v", what, acts, wantActs)
+		}
+	}
+	for name, want := range files {
+		if got := x.localData(name); got != want[0] {
+			x.t.Errorf("%s: local %s has %q, want %q", what, name, got, want[0])
+		}
+		if got := x.remoteData(name); got != want[1] {
+			x.t.Errorf("%s: remote %s has %q, want %q", what, name, got, want[1])
+		}
+	}
+}
+
+// synced prepares file a.txt equal on both sides and recorded in state
+func (x *syncFixture) synced() {
+	x.t.Helper()
+	x.putLocal("a.txt", "a", syncTime)
+	acts := x.run(SyncNewerWins, false)
+	x.check("initial sync", acts, []Action{{Op: SyncUpload, Path: "a.txt"}}, map[string][2]string{"a.txt": {"a", "a"}})
+	x.check("repeated sync", x.run(SyncNewerWins, false), nil, nil)
+}
+
+func TestSyncEdits(t *testing.T) {
+	x := newSyncFixture(t)
+	x.synced()
+
+	x.putLocal("a.txt", "local edit", syncTime.Add(time.Hour))
+	x.check("local edit", x.run(SyncNewerWins, false),
+		[]Action{{Op: SyncUpload, Path: "a.txt"}},
+		map[string][2]string{"a.txt": {"local edit", "local edit"}})
+
+	x.putRemote("a.txt", "remote edit", syncTime.Add(2*time.Hour))
+	x.check("remote edit", x.run(SyncNewerWins, false),
+		[]Action{{Op: SyncDownload, Path: "a.txt"}},
+		map[string][2]string{"a.txt": {"remote edit", "remote edit"}})
+
+	x.putRemote("b.txt", "new remote", syncTime)
+	x.putLocal("c.txt", "new local", syncTime)
+	x.check("new files", x.run(SyncNewerWins, false),
+		[]Action{{Op: SyncDownload, Path: "b.txt"}, {Op: SyncUpload, Path: "c.txt"}},
+		map[string][2]string{"b.txt": {"new remote", "new remote"}, "c.txt": {"new local", "new local"}})
+	x.check("after edits", x.run(SyncNewerWins, false), nil, nil)
+}
+
+func TestSyncDeletes(t *testing.T) {
+	x := newSyncFixture(t)
+	x.synced()
+	x.putLocal("b.txt", "b", syncTime)
+	x.putLocal("dir/c.txt", "c", syncTime)
+	x.run(SyncNewerWins, false)
+
+	if err := os.Remove(filepath.Join(x.local, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	x.check("local delete", x.run(SyncNewerWins, false),
+		[]Action{{Op: SyncDeleteRemote, Path: "a.txt"}},
+		map[string][2]string{"a.txt": {"-", "-"}, "b.txt": {"b", "b"}})
+
+	node, err := x.root.Get("b.txt")
+	if err == nil {
+		err = node.Delete()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := x.root.Get("dir")
+	if err == nil {
+		err = dir.Delete()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.check("remote delete", x.run(SyncNewerWins, false),
+		[]Action{{Op: SyncDeleteLocal, Path: "b.txt"}, {Op: SyncDeleteLocal, Path: "dir"}},
+		map[string][2]string{"b.txt": {"-", "-"}})
+	backup := strings.TrimSuffix(x.state, ".json") + ".trash"
+	for name, want := range map[string]string{"b.txt": "b", "dir/c.txt": "c"} {
+		data, err := os.ReadFile(filepath.Join(backup, filepath.FromSlash(name)))
+		if err != nil || string(data) != want {
+			t.Errorf("backup of %s has %q, %v", name, data, err)
+		}
+	}
+}
+
+func TestSyncDeleteChangedOnOtherSide(t *testing.T) {
+	x := newSyncFixture(t)
+	x.synced()
+	// deleted locally but edited remotely, remote edit wins
+	if err := os.Remove(filepath.Join(x.local, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	x.putRemote("a.txt", "remote edit", syncTime.Add(time.Hour))
+	x.check("local delete, remote edit", x.run(SyncNewerWins, false),
+		[]Action{{Op: SyncDownload, Path: "a.txt"}},
+		map[string][2]string{"a.txt": {"remote edit", "remote edit"}})
+
+	// deleted remotely but edited locally, local edit wins
+	node, err := x.root.Get("a.txt")
+	if err == nil {
+		err = node.Delete()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.putLocal("a.txt", "local edit", syncTime.Add(2*time.Hour))
+	x.check("remote delete, local edit", x.run(SyncNewerWins, false),
+		[]Action{{Op: SyncUpload, Path: "a.txt"}},
+		map[string][2]string{"a.txt": {"local edit", "local edit"}})
+}
+
+func TestSyncConflicts(t *testing.T) {
+	tests := []struct {
+		policy      SyncPolicy
+		localLater  bool
+		acts        []Action
+		local       string
+		remote      string
+		renamedCopy string
+	}{
+		{SyncNewerWins, true, []Action{{Op: SyncConflict, Path: "a.txt"}, {Op: SyncUpload, Path: "a.txt"}}, "local", "local", "-"},
+		{SyncNewerWins, false, []Action{{Op: SyncConflict, Path: "a.txt"}, {Op: SyncDownload, Path: "a.txt"}}, "remote", "remote", "-"},
+		{SyncLocalWins, false, []Action{{Op: SyncConflict, Path: "a.txt"}, {Op: SyncUpload, Path: "a.txt"}}, "local", "local", "-"},
+		{SyncRemoteWins, true, []Action{{Op: SyncConflict, Path: "a.txt"}, {Op: SyncDownload, Path: "a.txt"}}, "remote", "remote", "-"},
+		{SyncKeepBoth, true, []Action{{Op: SyncConflict, Path: "a.txt"}, {Op: SyncUpload, Path: "a.txt"}, {Op: SyncDownload, Path: "a.txt"}}, "remote", "remote", "local"},
+	}
+	for _, tt := range tests {
+		x := newSyncFixture(t)
+		x.synced()
+		localTime, remoteTime := syncTime.Add(time.Hour), syncTime.Add(2*time.Hour)
+		if tt.localLater {
+			localTime, remoteTime = remoteTime, localTime
+		}
+		x.putLocal("a.txt", "local", localTime)
+		x.putRemote("a.txt", "remote", remoteTime)
+		what := fmt.Sprintf("policy %d", tt.policy)
+		x.check(what, x.run(tt.policy, false), tt.acts,
+			map[string][2]string{"a.txt": {tt.local, tt.remote}})
+		if got := x.remoteData("a 2.txt"); got != tt.renamedCopy {
+			t.Errorf("%s: renamed copy has %q, want %q", what, got, tt.renamedCopy)
+		}
+	}
+}
+
+func TestSyncMissingState(t *testing.T) {
+	x := newSyncFixture(t)
+	x.synced()
+	x.putRemote("b.txt", "remote", syncTime)
+	x.putLocal("c.txt", "local", syncTime)
+	x.putLocal("a.txt", "local edit", syncTime.Add(time.Hour))
+	if err := os.Remove(x.state); err != nil {
+		t.Fatal(err)
+	}
+	// without state nothing is deleted and differing files conflict
+	x.check("missing state", x.run(SyncNewerWins, false),
+		[]Action{
+			{Op: SyncConflict, Path: "a.txt"}, {Op: SyncUpload, Path: "a.txt"},
+			{Op: SyncDownload, Path: "b.txt"}, {Op: SyncUpload, Path: "c.txt"},
+		},
+		map[string][2]string{"a.txt": {"local edit", "local edit"}, "b.txt": {"remote", "remote"}, "c.txt": {"local", "local"}})
+}
+
+func TestSyncStaleState(t *testing.T) {
+	x := newSyncFixture(t)
+	x.synced()
+	stale, err := os.ReadFile(x.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.putLocal("a.txt", "first edit", syncTime.Add(time.Hour))
+	x.run(SyncNewerWins, false)
+	x.putLocal("a.txt", "second edit", syncTime.Add(2*time.Hour))
+	if err = os.WriteFile(x.state, stale, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// both sides differ from stale state, so it's a conflict rather than an edit
+	x.check("stale state", x.run(SyncNewerWins, false),
+		[]Action{{Op: SyncConflict, Path: "a.txt"}, {Op: SyncUpload, Path: "a.txt"}},
+		map[string][2]string{"a.txt": {"second edit", "second edit"}})
+}
+
+func TestSyncDryRun(t *testing.T) {
+	x := newSyncFixture(t)
+	x.synced()
+	saved, err := os.ReadFile(x.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(filepath.Join(x.local, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	x.putRemote("b.txt", "b", syncTime)
+	x.putLocal("dir/c.txt", "c", syncTime)
+	want := []Action{
+		{Op: SyncDeleteRemote, Path: "a.txt"},
+		{Op: SyncDownload, Path: "b.txt"},
+		{Op: SyncMkdirRemote, Path: "dir"},
+		{Op: SyncUpload, Path: "dir/c.txt"},
+	}
+	for i := 0; i < 2; i++ {
+		x.check("dry run", x.run(SyncNewerWins, true), want,
+			map[string][2]string{"a.txt": {"-", "a"}, "b.txt": {"-", "b"}, "dir/c.txt": {"c", "-"}})
+	}
+	if state, _ := os.ReadFile(x.state); string(state) != string(saved) {
+		t.Errorf("dry run changed state")
+	}
+	if _, err = x.root.Get("dir"); err == nil {
+		t.Errorf("dry run created remote folder")
+	}
+}
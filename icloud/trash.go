@@ -0,0 +1,100 @@
+package icloud
+
+import (
+	"time"
+
+	"github.com/ivandeex/go-icloud/icloud/api"
+)
+
+// trashRootID is the drivews id of the trash bin
+const trashRootID = "TRASH_ROOT"
+
+// Trash returns items in the trash bin
+func (d *DriveService) Trash() ([]*DriveNode, error) {
+	item, err := d.getItemDetails(trashRootID)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*DriveNode{}
+	for _, child := range item.Items {
+		nodes = append(nodes, &DriveNode{
+			d: d,
+			i: child,
+		})
+	}
+	return nodes, nil
+}
+
+// RestorePath returns original location of a trashed node
+func (n *DriveNode) RestorePath() string { return n.i.RestorePath }
+
+// Expires returns the time when trashed node will be purged by iCloud
+func (n *DriveNode) Expires() time.Time { return n.i.Expires }
+
+// Restore puts a trashed node back to its original location
+// and drops cached listing of the folder receiving it
+func (n *DriveNode) Restore() error {
+	items, err := n.d.putBackFromTrash(n.i.DriveID, n.Etag())
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		n.d.cache.clear() // destination is known only by restore path
+		if n.d.root != nil {
+			n.d.root.Stale()
+		}
+		return nil
+	}
+	for _, item := range items {
+		n.d.cache.invalidate(item.ParentID)
+		if n.d.root != nil && item.ParentID == rootDriveID {
+			n.d.root.Stale()
+		}
+	}
+	return nil
+}
+
+// DeleteForever permanently removes a trashed node
+func (n *DriveNode) DeleteForever() error {
+	return n.d.deleteItems([]*api.DriveItem{n.i})
+}
+
+// EmptyTrash permanently removes all items from the trash bin
+func (d *DriveService) EmptyTrash() error {
+	item, err := d.getItemDetails(trashRootID)
+	if err != nil || len(item.Items) == 0 {
+		return err
+	}
+	return d.deleteItems(item.Items)
+}
+
+// putBackFromTrash restores item from trash bin and returns restored items
+func (d *DriveService) putBackFromTrash(nodeID, etag string) ([]*api.DriveItem, error) {
+	nodeData := dict{
+		"drivewsid": nodeID,
+		"etag":      etag,
+	}
+	data := dict{
+		"items": []dict{nodeData},
+	}
+	var res api.DriveItemsResult
+	if err := d.c.post(d.svcRoot+"/putBackItemsFromTrash", data, nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Items, nil
+}
+
+// deleteItems permanently removes trashed items
+func (d *DriveService) deleteItems(items []*api.DriveItem) error {
+	nodes := []dict{}
+	for _, item := range items {
+		nodes = append(nodes, dict{
+			"drivewsid": item.DriveID,
+			"etag":      item.Etag,
+		})
+	}
+	data := dict{
+		"items": nodes,
+	}
+	return d.c.post(d.svcRoot+"/deleteItems", data, nil, nil)
+}
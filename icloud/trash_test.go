@@ -0,0 +1,144 @@
+package icloud
+
+import (
+	"testing"
+)
+
+// trashNames returns names of trashed items
+func trashNames(t *testing.T, d *DriveService) []string {
+	t.Helper()
+	nodes, err := d.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, node := range nodes {
+		names = append(names, node.Name())
+	}
+	return names
+}
+
+// trashFile moves a file of root folder to trash
+func trashFile(t *testing.T, root *DriveNode, name string) {
+	t.Helper()
+	node, err := root.Get(name)
+	if err == nil {
+		err = node.Delete()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrashRestore(t *testing.T) {
+	f, d := newFakeDrive(t)
+	d.EnableCache(CacheOptions{})
+	docsID := f.add("root", "docs", "", true, "")
+	f.add(docsID, "a", "txt", false, "aaa")
+	f.add("root", "b", "txt", false, "bbb")
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := root.Get("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashFile(t, docs, "a.txt")
+	trashFile(t, root, "b.txt")
+
+	nodes, err := d.Trash()
+	if err != nil || len(nodes) != 2 {
+		t.Fatalf("got %d trashed items, %v", len(nodes), err)
+	}
+	for _, node := range nodes {
+		if node.Parent() != nil || node.RestorePath() == "" {
+			t.Errorf("%s: parent %v, restore path %q", node.Name(), node.Parent(), node.RestorePath())
+		}
+		if err = node.Restore(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names := trashNames(t, d); len(names) != 0 {
+		t.Errorf("trash still has %v", names)
+	}
+	if d.cache.lookup(docs.ID(), "") != nil {
+		t.Error("listing of restore destination is still cached")
+	}
+	if _, err = root.Get("b.txt"); err != nil {
+		t.Errorf("restored file is not in root: %v", err)
+	}
+	docs, err = root.Get("docs")
+	if err == nil {
+		_, err = docs.Get("a.txt")
+	}
+	if err != nil {
+		t.Errorf("restored file is not in its folder: %v", err)
+	}
+}
+
+func TestTrashRestoreBare(t *testing.T) {
+	f, d := newFakeDrive(t)
+	d.EnableCache(CacheOptions{})
+	f.add("root", "a", "txt", false, "aaa")
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashFile(t, root, "a.txt")
+	nodes, err := d.Trash()
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("got %d trashed items, %v", len(nodes), err)
+	}
+	f.bare = true
+	if err = nodes[0].Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = root.Get("a.txt"); err != nil {
+		t.Errorf("restored file is not listed: %v", err)
+	}
+}
+
+func TestTrashPurge(t *testing.T) {
+	f, d := newFakeDrive(t)
+	for _, name := range []string{"a", "b", "c"} {
+		f.add("root", name, "txt", false, name)
+	}
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		trashFile(t, root, name)
+	}
+
+	nodes, err := d.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range nodes {
+		if node.Name() == "a.txt" {
+			if err = node.DeleteForever(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if names := trashNames(t, d); len(names) != 2 {
+		t.Errorf("after purge trash has %v", names)
+	}
+	if err = d.EmptyTrash(); err != nil {
+		t.Fatal(err)
+	}
+	if names := trashNames(t, d); len(names) != 0 {
+		t.Errorf("after emptying trash has %v", names)
+	}
+	if len(f.data) != 0 {
+		t.Errorf("content left on server: %v", f.data)
+	}
+	if n := f.countCalls("/deleteItems"); n != 2 {
+		t.Errorf("got %d delete requests, want 2", n)
+	}
+	if err = d.EmptyTrash(); err != nil || f.countCalls("/deleteItems") != 2 {
+		t.Errorf("emptying empty trash: %v", err)
+	}
+}
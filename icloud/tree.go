@@ -0,0 +1,198 @@
+package icloud
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// TreeError collects errors of individual files in a folder transfer
+type TreeError struct {
+	Errors []error
+}
+
+// Error implements error
+func (e *TreeError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d files failed, first error: %v", len(e.Errors), e.Errors[0])
+}
+
+// Unwrap returns individual errors
+func (e *TreeError) Unwrap() []error { return e.Errors }
+
+// Is tells whether any individual error matches target,
+// so errors.Is works without support of multiple wrapped errors
+func (e *TreeError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first individual error matching target
+func (e *TreeError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// add records error of a file
+func (e *TreeError) add(path string, err error) {
+	e.Errors = append(e.Errors, fmt.Errorf("%s: %w", path, err))
+}
+
+// result returns nil if there were no errors
+func (e *TreeError) result() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Include uploads or downloads only files matching any of glob patterns.
+// Patterns are matched against slash-separated relative path and base name.
+func Include(patterns ...string) TransferOption {
+	return func(o *transferOptions) { o.include = append(o.include, patterns...) }
+}
+
+// Exclude skips files and folders matching any of glob patterns
+func Exclude(patterns ...string) TransferOption {
+	return func(o *transferOptions) { o.exclude = append(o.exclude, patterns...) }
+}
+
+// matchAny returns true if relative path or its base name matches a pattern
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// included applies include and exclude filters to a relative path
+func (o *transferOptions) included(rel string, isDir bool) bool {
+	if matchAny(o.exclude, rel) {
+		return false
+	}
+	return isDir || len(o.include) == 0 || matchAny(o.include, rel)
+}
+
+// UploadDir uploads local directory tree into the folder.
+// Existing files are replaced unless they have the same size and
+// modification time, OnConflict option can change that.
+// Files failing to upload are reported in *TreeError
+// after the rest of the tree is uploaded. Symbolic links are not
+// followed, they are skipped like other special files and reported
+// with ErrNotRegular.
+func (n *DriveNode) UploadDir(localDir string, opts ...TransferOption) error {
+	if !n.IsDir() {
+		return ErrNotDir
+	}
+	opts = append([]TransferOption{OnConflict(ConflictUpdate)}, opts...)
+	o := newTransferOptions(opts)
+	errs := &TreeError{}
+	n.uploadDir(localDir, "", o, opts, errs)
+	return errs.result()
+}
+
+func (n *DriveNode) uploadDir(localDir, rel string, o *transferOptions, opts []TransferOption, errs *TreeError) {
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		errs.add(localDir, err)
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		localPath := filepath.Join(localDir, name)
+		relPath := path.Join(rel, name)
+		if !o.included(relPath, entry.IsDir()) {
+			continue
+		}
+		if !entry.IsDir() {
+			if !entry.Type().IsRegular() {
+				errs.add(localPath, ErrNotRegular)
+			} else if _, err := n.Upload(localPath, opts...); err != nil {
+				errs.add(localPath, err)
+			}
+			continue
+		}
+		remoteName := n.d.RemoteName(name)
+		folder, err := n.Get(remoteName)
+		if errors.Is(err, ErrNotFound) {
+			folder, err = n.Mkdir(remoteName)
+		}
+		if err == nil && !folder.IsDir() {
+			err = ErrNotDir
+		}
+		if err != nil {
+			errs.add(localPath, err)
+			continue
+		}
+		folder.uploadDir(localPath, relPath, o, opts, errs)
+	}
+}
+
+// DownloadDir downloads folder tree into local directory
+// preserving modification times. Failed downloads and names
+// invalid on local file system are reported in *TreeError.
+func (n *DriveNode) DownloadDir(localDir string, opts ...TransferOption) error {
+	if !n.IsDir() {
+		return ErrNotDir
+	}
+	o := newTransferOptions(opts)
+	errs := &TreeError{}
+	n.downloadDir(localDir, "", o, opts, errs)
+	return errs.result()
+}
+
+func (n *DriveNode) downloadDir(localDir, rel string, o *transferOptions, opts []TransferOption, errs *TreeError) {
+	if err := os.MkdirAll(localDir, 0o755); err != nil {
+		errs.add(localDir, err)
+		return
+	}
+	children, err := n.Children()
+	if err != nil {
+		errs.add(localDir, err)
+		return
+	}
+	for _, child := range children {
+		name := n.d.LocalName(child.Name())
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			errs.add(path.Join(rel, child.Name()), fmt.Errorf("invalid local file name %q", name))
+			continue
+		}
+		localPath := filepath.Join(localDir, name)
+		relPath := path.Join(rel, child.Name())
+		if !o.included(relPath, child.IsDir()) {
+			continue
+		}
+		if child.IsDir() {
+			child.downloadDir(localPath, relPath, o, opts, errs)
+		} else {
+			err = child.Download(localPath, opts...)
+			if mtime := child.Modified(); err == nil && !mtime.IsZero() {
+				err = os.Chtimes(localPath, mtime, mtime)
+			}
+			if err != nil {
+				errs.add(localPath, err)
+			}
+		}
+	}
+	if mtime := n.Modified(); rel != "" && !mtime.IsZero() {
+		_ = os.Chtimes(localDir, mtime, mtime)
+	}
+}
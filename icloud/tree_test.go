@@ -0,0 +1,99 @@
+package icloud
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestUploadDirAgain(t *testing.T) {
+	f, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"a.txt": "a", "dir/b.txt": "b"})
+	if err = root.UploadDir(local); err != nil {
+		t.Fatal(err)
+	}
+	uploads := f.countCalls("/ws/com.apple.CloudDocs/upload/")
+	if err = root.UploadDir(local); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.countCalls("/ws/com.apple.CloudDocs/upload/"); n != uploads {
+		t.Errorf("unchanged tree uploaded %d files", n-uploads)
+	}
+
+	writeTree(t, local, map[string]string{"a.txt": "changed"})
+	mtime := time.Now().Add(time.Hour)
+	if err = os.Chtimes(filepath.Join(local, "a.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err = root.UploadDir(local); err != nil {
+		t.Fatal(err)
+	}
+	names, err := root.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if want := []string{"a.txt", "dir"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("root lists %v, want %v", names, want)
+	}
+	node, err := root.Get("a.txt")
+	if err != nil || node.Size() != int64(len("changed")) {
+		t.Errorf("changed file was not replaced: %v", err)
+	}
+}
+
+func TestUploadDirSymlink(t *testing.T) {
+	_, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"a.txt": "a"})
+	if err = os.Symlink("a.txt", filepath.Join(local, "link")); err != nil {
+		t.Skip(err)
+	}
+	err = root.UploadDir(local)
+	var treeErr *TreeError
+	if !errors.As(err, &treeErr) || len(treeErr.Errors) != 1 || !errors.Is(err, ErrNotRegular) {
+		t.Fatalf("got %v, want skipped link reported", err)
+	}
+	if names, _ := root.Dir(); !reflect.DeepEqual(names, []string{"a.txt"}) {
+		t.Errorf("root lists %v", names)
+	}
+}
+
+func TestTreeErrorMatching(t *testing.T) {
+	errs := &TreeError{}
+	errs.add("a", ErrChecksum)
+	errs.add("b", &fs.PathError{Op: "open", Path: "b", Err: fs.ErrPermission})
+	err := fmt.Errorf("upload: %w", errs.result())
+	if !errors.Is(err, ErrChecksum) || !errors.Is(err, fs.ErrPermission) {
+		t.Error("individual errors do not match")
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("unrelated error matches")
+	}
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "b" {
+		t.Errorf("got path error %v", pathErr)
+	}
+	var treeErr *TreeError
+	if !errors.As(err, &treeErr) || treeErr != errs {
+		t.Error("tree error is not found")
+	}
+	if (&TreeError{}).result() != nil {
+		t.Error("empty tree error is not nil")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -34,6 +35,15 @@ func (c *Client) getWebserviceURL(service string) (string, error) {
 	return c.data.Webservices.URL(service)
 }
 
+// dataPath returns path of a file in the client data directory.
+// It returns empty string if client keeps no session on disk.
+func (c *Client) dataPath(name string) string {
+	if c.sessPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(c.sessPath), name)
+}
+
 func ReadLine(prompt string) string {
 	var (
 		line string
@@ -0,0 +1,217 @@
+package icloud
+
+import (
+	"context"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/ivandeex/go-icloud/icloud/api"
+)
+
+// EventType tells what happened to a drive item
+type EventType int
+
+// Watch event types
+const (
+	EventCreate EventType = iota
+	EventModify
+	EventRename
+	EventDelete
+	EventError
+)
+
+// String returns event type name
+func (t EventType) String() string {
+	switch t {
+	case EventCreate:
+		return "create"
+	case EventModify:
+		return "modify"
+	case EventRename:
+		return "rename"
+	case EventDelete:
+		return "delete"
+	case EventError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// DriveEvent describes a change detected by Watch
+type DriveEvent struct {
+	Type    EventType
+	ID      string // drivews id of the item
+	Path    string // slash-separated path relative to watched folder
+	OldPath string // previous path of renamed or moved item
+	IsDir   bool
+	Err     error // polling error of EventError
+}
+
+// watchEntry is a known state of an item
+type watchEntry struct {
+	path    string
+	parent  string
+	dir     bool
+	etag    string
+	changed time.Time
+}
+
+// snapshot maps drivews ids of watched tree to their state
+type snapshot map[string]*watchEntry
+
+// minWatchInterval is the shortest delay between polls of Watch
+const minWatchInterval = time.Second
+
+// Watch polls a folder tree and sends change events until context is done.
+// Only subfolders with changed etags are listed again on each poll.
+// Interval shorter than a second is raised to it.
+// The channel is closed when watching stops.
+func (d *DriveService) Watch(ctx context.Context, root *DriveNode, interval time.Duration) <-chan DriveEvent {
+	if interval < minWatchInterval {
+		interval = minWatchInterval
+	}
+	events := make(chan DriveEvent)
+	go func() {
+		defer close(events)
+		var last snapshot
+		for {
+			cur := snapshot{}
+			err := d.watchScan(ctx, root.ID(), "", last, cur, last.children())
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil:
+				cur = last
+				if !sendEvent(ctx, events, DriveEvent{Type: EventError, Err: err}) {
+					return
+				}
+			case last != nil:
+				for _, ev := range diffSnapshots(last, cur) {
+					if !sendEvent(ctx, events, ev) {
+						return
+					}
+				}
+			}
+			last = cur
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+	return events
+}
+
+// sendEvent sends event unless context is done
+func sendEvent(ctx context.Context, events chan<- DriveEvent, ev DriveEvent) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// children returns ids of items by parent id
+func (s snapshot) children() map[string][]string {
+	index := map[string][]string{}
+	for id, entry := range s {
+		index[entry.parent] = append(index[entry.parent], id)
+	}
+	return index
+}
+
+// watchScan lists a folder and its subfolders with changed etags
+func (d *DriveService) watchScan(ctx context.Context, folderID, dir string, last, cur snapshot, index map[string][]string) error {
+	item, err := d.getItemDetailsContext(ctx, folderID)
+	if err != nil {
+		return err
+	}
+	for _, child := range item.Items {
+		entry := newWatchEntry(child, folderID, dir)
+		cur[child.DriveID] = entry
+		if !entry.dir {
+			continue
+		}
+		if prev := last[child.DriveID]; prev != nil && prev.dir && prev.etag == entry.etag {
+			copySubtree(child.DriveID, entry.path, last, cur, index)
+			continue
+		}
+		if err := d.watchScan(ctx, child.DriveID, entry.path, last, cur, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newWatchEntry returns state of an item
+func newWatchEntry(item *api.DriveItem, parentID, dir string) *watchEntry {
+	node := &DriveNode{i: item}
+	return &watchEntry{
+		path:    path.Join(dir, node.Name()),
+		parent:  parentID,
+		dir:     node.IsDir(),
+		etag:    item.Etag,
+		changed: item.Changed,
+	}
+}
+
+// copySubtree copies unchanged folder contents into new snapshot
+// adjusting paths in case the folder was renamed or moved
+func copySubtree(folderID, dir string, last, cur snapshot, index map[string][]string) {
+	for _, id := range index[folderID] {
+		entry := *last[id]
+		entry.path = path.Join(dir, path.Base(entry.path))
+		cur[id] = &entry
+		if entry.dir {
+			copySubtree(id, entry.path, last, cur, index)
+		}
+	}
+}
+
+// diffSnapshots returns events turning one snapshot into another.
+// Renaming or moving a folder yields a single event for the folder,
+// not for every item beneath it.
+func diffSnapshots(last, cur snapshot) []DriveEvent {
+	events := []DriveEvent{}
+	for id, entry := range cur {
+		ev := DriveEvent{ID: id, Path: entry.path, IsDir: entry.dir}
+		prev := last[id]
+		switch {
+		case prev == nil:
+			ev.Type = EventCreate
+		case prev.path != entry.path && !movedWithParent(prev, entry, last, cur):
+			ev.Type = EventRename
+			ev.OldPath = prev.path
+		case !entry.dir && (prev.etag != entry.etag || !prev.changed.Equal(entry.changed)):
+			ev.Type = EventModify
+		default:
+			continue
+		}
+		events = append(events, ev)
+	}
+	for id, entry := range last {
+		if cur[id] == nil {
+			events = append(events, DriveEvent{Type: EventDelete, ID: id, Path: entry.path, IsDir: entry.dir})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Path != events[j].Path {
+			return events[i].Path < events[j].Path
+		}
+		return events[i].Type < events[j].Type
+	})
+	return events
+}
+
+// movedWithParent tells whether an item only follows its renamed parent,
+// keeping its name and place in it
+func movedWithParent(prev, entry *watchEntry, last, cur snapshot) bool {
+	if prev.parent != entry.parent || path.Base(prev.path) != path.Base(entry.path) {
+		return false
+	}
+	oldParent, newParent := last[entry.parent], cur[entry.parent]
+	return oldParent != nil && newParent != nil && oldParent.path != newParent.path
+}
@@ -0,0 +1,141 @@
+package icloud
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchClampsInterval(t *testing.T) {
+	f, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := f.countCalls("/retrieveItemDetailsInFolders")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	for range d.Watch(ctx, root, 0) {
+	}
+	if n := f.countCalls("/retrieveItemDetailsInFolders") - calls; n != 1 {
+		t.Errorf("polled %d times with zero interval, want 1", n)
+	}
+}
+
+func TestWatchCancelsListing(t *testing.T) {
+	f, d := newFakeDrive(t)
+	root, err := d.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.hangList = true
+	f.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ev := range d.Watch(ctx, root, time.Minute) {
+			t.Errorf("got event %+v", ev)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop while listing a folder")
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	t1, t2 := time.Unix(1600000000, 0), time.Unix(1600001000, 0)
+	base := func() snapshot {
+		return snapshot{
+			"d":  {path: "d", parent: "root", dir: true, etag: "1"},
+			"e":  {path: "d/e", parent: "d", dir: true, etag: "1"},
+			"f":  {path: "d/f.txt", parent: "d", etag: "1", changed: t1},
+			"g":  {path: "d/e/g.txt", parent: "e", etag: "1", changed: t1},
+			"h":  {path: "h.txt", parent: "root", etag: "1", changed: t1},
+			"d2": {path: "d2", parent: "root", dir: true, etag: "1"},
+		}
+	}
+	tests := []struct {
+		name   string
+		change func(s snapshot)
+		want   []DriveEvent
+	}{{
+		name:   "unchanged",
+		change: func(s snapshot) {},
+		want:   []DriveEvent{},
+	}, {
+		name: "create",
+		change: func(s snapshot) {
+			s["n"] = &watchEntry{path: "d/n.txt", parent: "d", etag: "1", changed: t2}
+		},
+		want: []DriveEvent{{Type: EventCreate, ID: "n", Path: "d/n.txt"}},
+	}, {
+		name: "modify",
+		change: func(s snapshot) {
+			s["f"].etag, s["f"].changed = "2", t2
+			s["d"].etag = "2"
+		},
+		want: []DriveEvent{{Type: EventModify, ID: "f", Path: "d/f.txt"}},
+	}, {
+		name: "delete",
+		change: func(s snapshot) {
+			delete(s, "h")
+		},
+		want: []DriveEvent{{Type: EventDelete, ID: "h", Path: "h.txt"}},
+	}, {
+		name: "rename",
+		change: func(s snapshot) {
+			s["h"].path = "i.txt"
+		},
+		want: []DriveEvent{{Type: EventRename, ID: "h", Path: "i.txt", OldPath: "h.txt"}},
+	}, {
+		name: "move",
+		change: func(s snapshot) {
+			s["h"].path, s["h"].parent = "d2/h.txt", "d2"
+		},
+		want: []DriveEvent{{Type: EventRename, ID: "h", Path: "d2/h.txt", OldPath: "h.txt"}},
+	}, {
+		name: "folder rename",
+		change: func(s snapshot) {
+			s["d"].path = "x"
+			s["e"].path = "x/e"
+			s["f"].path = "x/f.txt"
+			s["g"].path = "x/e/g.txt"
+		},
+		want: []DriveEvent{{Type: EventRename, ID: "d", Path: "x", OldPath: "d", IsDir: true}},
+	}, {
+		name: "rename in renamed folder",
+		change: func(s snapshot) {
+			s["d"].path = "x"
+			s["e"].path = "x/e"
+			s["f"].path = "x/f2.txt"
+			s["g"].path = "x/e/g.txt"
+		},
+		want: []DriveEvent{
+			{Type: EventRename, ID: "d", Path: "x", OldPath: "d", IsDir: true},
+			{Type: EventRename, ID: "f", Path: "x/f2.txt", OldPath: "d/f.txt"},
+		},
+	}, {
+		name: "folder move",
+		change: func(s snapshot) {
+			s["e"].path, s["e"].parent = "d2/e", "d2"
+			s["g"].path = "d2/e/g.txt"
+		},
+		want: []DriveEvent{{Type: EventRename, ID: "e", Path: "d2/e", OldPath: "d/e", IsDir: true}},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur := base()
+			tt.change(cur)
+			got := diffSnapshots(base(), cur)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,458 @@
+package icloud
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// WritableFile is a file opened for reading and writing
+type WritableFile interface {
+	fs.File
+	io.Writer
+	io.Seeker
+}
+
+// WritableFS is a writable file system.
+// It is implemented by DriveFS and LocalFS.
+type WritableFS interface {
+	fs.FS
+	Create(name string) (WritableFile, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error)
+	Mkdir(name string, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldname, newname string) error
+	// Chtimes is a full re-upload of the file on DriveFS, see there
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// MaxChtimesSize is the largest file whose time DriveFS.Chtimes changes
+const MaxChtimesSize = 16 << 20
+
+// parent returns parent folder of a path and the base name
+func (f *DriveFS) parent(op, name string) (*DriveNode, string, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	dir, base := path.Split(name)
+	folder, err := f.lookup(op, path.Clean(dir))
+	if err != nil {
+		return nil, "", err
+	}
+	if !folder.IsDir() {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return folder, base, nil
+}
+
+// Create creates or truncates a file
+func (f *DriveFS) Create(name string) (WritableFile, error) {
+	return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile opens a file with given flags.
+// Writes go to a temporary file which is uploaded on Close.
+func (f *DriveFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		file, err := f.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &readOnlyFile{file.(*driveFile)}, nil
+	}
+	folder, base, err := f.parent("open", name)
+	if err != nil {
+		return nil, err
+	}
+	node, err := folder.Get(base)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if flag&os.O_CREATE == 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		node = nil
+	case err != nil:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case node.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrNotFile}
+	}
+
+	tmp, err := os.CreateTemp("", "icloud-*")
+	if err == nil && node != nil && flag&os.O_TRUNC == 0 {
+		// keep existing content
+		var in io.ReadCloser
+		if in, err = node.Open(); err == nil {
+			_, err = io.Copy(tmp, in)
+			_ = in.Close()
+		}
+		if err == nil && flag&os.O_APPEND == 0 {
+			_, err = tmp.Seek(0, io.SeekStart)
+		}
+	}
+	if err != nil {
+		if tmp != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &writableFile{
+		tmp:    tmp,
+		folder: folder,
+		node:   node,
+		name:   base,
+		dirty:  node == nil || flag&os.O_TRUNC != 0,
+	}, nil
+}
+
+// Mkdir creates a folder
+func (f *DriveFS) Mkdir(name string, perm fs.FileMode) error {
+	folder, base, err := f.parent("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if _, err = folder.Get(base); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if _, err = folder.Mkdir(base); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+// MkdirAll creates a folder with all missing parents
+func (f *DriveFS) MkdirAll(name string, perm fs.FileMode) error {
+	node, err := f.lookup("mkdir", name)
+	if err == nil {
+		if !node.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: ErrNotDir}
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if dir := path.Dir(name); dir != "." {
+		if err = f.MkdirAll(dir, perm); err != nil {
+			return err
+		}
+	}
+	return f.Mkdir(name, perm)
+}
+
+// Remove moves a file or an empty folder to trash
+func (f *DriveFS) Remove(name string) error {
+	folder, base, err := f.parent("remove", name)
+	if err != nil {
+		return err
+	}
+	node, err := folder.Get(base)
+	if err == nil && node.IsDir() {
+		var children []*DriveNode
+		if children, err = node.Children(); err == nil && len(children) > 0 {
+			err = ErrNotEmpty
+		}
+	}
+	if err == nil {
+		err = node.Delete()
+	}
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fsError(err)}
+	}
+	return nil
+}
+
+// RemoveAll moves a file or a folder tree to trash.
+// Missing path is not an error.
+func (f *DriveFS) RemoveAll(name string) error {
+	folder, base, err := f.parent("remove", name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	node, err := folder.Get(base)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err == nil {
+		err = node.Delete()
+	}
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Rename renames or moves a file or folder replacing existing target file
+func (f *DriveFS) Rename(oldname, newname string) error {
+	fail := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fsError(err)}
+	}
+	srcFolder, srcBase, err := f.parent("rename", oldname)
+	if err != nil {
+		return err
+	}
+	dstFolder, dstBase, err := f.parent("rename", newname)
+	if err != nil {
+		return err
+	}
+	node, err := srcFolder.Get(srcBase)
+	if err != nil {
+		return fail(err)
+	}
+	if target, err := dstFolder.Get(dstBase); err == nil && target.ID() != node.ID() {
+		if target.IsDir() {
+			return fail(ErrExists)
+		}
+		if err = target.Delete(); err != nil {
+			return fail(err)
+		}
+	}
+	if srcFolder.ID() != dstFolder.ID() {
+		if err = node.Move(dstFolder); err != nil {
+			return fail(err)
+		}
+	}
+	if srcBase != dstBase {
+		if _, err = node.Rename(dstBase); err != nil {
+			return fail(err)
+		}
+	}
+	return nil
+}
+
+// Chtimes changes modification time of a file.
+// It is not a cheap metadata call: iCloud keeps times with content,
+// so a new time means downloading and uploading the whole file again.
+// Files larger than MaxChtimesSize yield ErrNotSupported instead.
+// Access time is ignored.
+func (f *DriveFS) Chtimes(name string, atime, mtime time.Time) error {
+	node, err := f.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+	if node.IsDir() {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: ErrNotSupported}
+	}
+	if node.Modified().Equal(mtime.Truncate(time.Millisecond)) {
+		return nil
+	}
+	if node.Size() > MaxChtimesSize {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: ErrNotSupported}
+	}
+	r, err := node.NewReader()
+	if err == nil {
+		err = node.Update(r, node.Size(), mtime)
+	}
+	if err != nil {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+	return nil
+}
+
+// readOnlyFile is a drive file opened without write flags
+type readOnlyFile struct {
+	*driveFile
+}
+
+// Write implements io.Writer
+func (f *readOnlyFile) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+}
+
+// writableFile buffers writes in a temporary file uploaded on Close
+type writableFile struct {
+	tmp    *os.File
+	folder *DriveNode
+	node   *DriveNode // existing file, if any
+	name   string
+	dirty  bool
+}
+
+// Stat implements fs.File, it reports the buffered content
+func (f *writableFile) Stat() (fs.FileInfo, error) {
+	fi, err := f.tmp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &namedFileInfo{FileInfo: fi, name: f.name}, nil
+}
+
+// namedFileInfo replaces name of temporary file
+type namedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+// Name implements fs.FileInfo
+func (fi *namedFileInfo) Name() string { return fi.name }
+
+// Read implements io.Reader
+func (f *writableFile) Read(p []byte) (int, error) { return f.tmp.Read(p) }
+
+// ReadAt implements io.ReaderAt
+func (f *writableFile) ReadAt(p []byte, off int64) (int, error) { return f.tmp.ReadAt(p, off) }
+
+// Seek implements io.Seeker
+func (f *writableFile) Seek(offset int64, whence int) (int64, error) {
+	return f.tmp.Seek(offset, whence)
+}
+
+// Write implements io.Writer
+func (f *writableFile) Write(p []byte) (int, error) {
+	f.dirty = true
+	return f.tmp.Write(p)
+}
+
+// WriteAt implements io.WriterAt
+func (f *writableFile) WriteAt(p []byte, off int64) (int, error) {
+	f.dirty = true
+	return f.tmp.WriteAt(p, off)
+}
+
+// Truncate changes file size
+func (f *writableFile) Truncate(size int64) error {
+	f.dirty = true
+	return f.tmp.Truncate(size)
+}
+
+// Close uploads changed content and removes the temporary file
+func (f *writableFile) Close() error {
+	// upload may fail before it gets to close the temporary file
+	defer func() {
+		_ = f.tmp.Close()
+		_ = os.Remove(f.tmp.Name())
+	}()
+	if !f.dirty {
+		return nil
+	}
+	fi, err := f.tmp.Stat()
+	if err == nil {
+		_, err = f.tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return err
+	}
+	mtime := time.Now()
+	if f.node != nil {
+		err = f.node.Update(f.tmp, fi.Size(), mtime)
+	} else {
+		f.node, err = f.folder.PutStream(f.tmp, f.name, fi.Size(), mtime, OnConflict(ConflictOverwrite))
+	}
+	return err
+}
+
+// LocalFS is a writable file system rooted at a local directory
+type LocalFS struct {
+	root string
+}
+
+// NewLocalFS returns local file system rooted at a directory
+func NewLocalFS(root string) *LocalFS {
+	return &LocalFS{root: root}
+}
+
+// path returns local path of a file system path
+func (l *LocalFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(l.root, filepath.FromSlash(name)), nil
+}
+
+// Open implements fs.FS
+func (l *LocalFS) Open(name string) (fs.File, error) {
+	p, err := l.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Create creates or truncates a file
+func (l *LocalFS) Create(name string) (WritableFile, error) {
+	return l.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile opens a file with given flags
+func (l *LocalFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	p, err := l.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, flag, perm)
+}
+
+// Mkdir creates a directory
+func (l *LocalFS) Mkdir(name string, perm fs.FileMode) error {
+	p, err := l.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(p, perm)
+}
+
+// MkdirAll creates a directory with all missing parents
+func (l *LocalFS) MkdirAll(name string, perm fs.FileMode) error {
+	p, err := l.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, perm)
+}
+
+// Remove removes a file or an empty directory
+func (l *LocalFS) Remove(name string) error {
+	p, err := l.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// RemoveAll removes a file or a directory tree
+func (l *LocalFS) RemoveAll(name string) error {
+	p, err := l.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+// Rename renames or moves a file or directory
+func (l *LocalFS) Rename(oldname, newname string) error {
+	oldPath, err := l.path("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newPath, err := l.path("rename", newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+// Chtimes changes access and modification times
+func (l *LocalFS) Chtimes(name string, atime, mtime time.Time) error {
+	p, err := l.path("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(p, atime, mtime)
+}
+
+// static check of implemented interfaces
+var (
+	_ WritableFS = (*DriveFS)(nil)
+	_ WritableFS = (*LocalFS)(nil)
+)
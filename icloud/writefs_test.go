@@ -0,0 +1,69 @@
+package icloud
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritableFileCloseOnError(t *testing.T) {
+	f, d := newFakeDrive(t)
+	fsys, err := d.FS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := fsys.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.WriteString(file, "data"); err != nil {
+		t.Fatal(err)
+	}
+	f.failCommit = 1
+	if err = file.Close(); err == nil {
+		t.Fatal("upload did not fail")
+	}
+	tmp := file.(*writableFile).tmp
+	if err = tmp.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("temporary file left open: %v", err)
+	}
+	if _, err = os.Stat(tmp.Name()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestDriveFSChtimes(t *testing.T) {
+	f, d := newFakeDrive(t)
+	f.add("root", "a", "txt", false, "data")
+	f.add("root", "big", "bin", false, strings.Repeat("x", MaxChtimesSize+1))
+	fsys, err := d.FS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	same := time.Unix(1600000000, 0)
+	if err = fsys.Chtimes("a.txt", same, same); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.countCalls("/ws/com.apple.CloudDocs/upload/"); n != 0 {
+		t.Errorf("unchanged time uploaded file %d times", n)
+	}
+	mtime := time.Unix(1700000000, 0)
+	if err = fsys.Chtimes("a.txt", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := fsys.Stat("a.txt")
+	if err != nil || !fi.ModTime().Equal(mtime) || fi.Size() != 4 {
+		t.Errorf("got %v, %v", fi, err)
+	}
+
+	f.calls = nil
+	if err = fsys.Chtimes("big.bin", mtime, mtime); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("large file got %v", err)
+	}
+	if n := f.countCalls("/ws/com.apple.CloudDocs/download/") + f.countCalls("/ws/com.apple.CloudDocs/upload/"); n != 0 {
+		t.Errorf("large file was transferred %d times", n)
+	}
+}